@@ -0,0 +1,230 @@
+package loglfshook
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"sync"
+	"sync/atomic"
+)
+
+// QueuePolicy decides what to do when the queue of the asynchronous mode is full.
+type QueuePolicy int
+
+const (
+	// QueueBlock blocks Fire until the queue has room.
+	QueueBlock QueuePolicy = iota
+	// QueueDropOldest drops the oldest queued entry to make room.
+	QueueDropOldest
+	// QueueDropNewest drops the entry being fired.
+	QueueDropNewest
+)
+
+// lfsEntry is a formatted entry waiting in the queue.
+type lfsEntry struct {
+	entry  *logrus.Entry
+	level  logrus.Level
+	path   string
+	routed bool
+	msg    []byte
+	dup    *lfsDup
+	// done is closed once the entry is written, if not nil.
+	done chan struct{}
+}
+
+// lfsQueueKey identifies the file of a queue, the routed files share one queue with an empty path,
+// so the queues don't grow with the routed paths evicted by MaxRouteFiles.
+type lfsQueueKey struct {
+	path   string
+	routed bool
+}
+
+// lfsQueue is the queue of a file drained by its own goroutine.
+// mu guards closed, the senders hold it for reading so the channel is never closed under them.
+type lfsQueue struct {
+	mu     sync.RWMutex
+	closed bool
+	ch     chan lfsEntry
+	done   chan struct{}
+}
+
+// queueGet returns the queue of the entry's file, starting it if needed.
+func (hook *LfsHook) queueGet(e lfsEntry) *lfsQueue {
+	hook.lock.Lock()
+	defer hook.lock.Unlock()
+	key := lfsQueueKey{path: e.path}
+	if e.routed {
+		key = lfsQueueKey{routed: true}
+	}
+	q, ok := hook.queues[key]
+	if !ok {
+		q = &lfsQueue{
+			ch:   make(chan lfsEntry, hook.QueueSize),
+			done: make(chan struct{}),
+		}
+		if hook.queues == nil {
+			hook.queues = make(map[lfsQueueKey]*lfsQueue)
+		}
+		hook.queues[key] = q
+		go hook.queueLoop(q)
+	}
+	return q
+}
+
+// enqueue queues the entry by the QueuePolicy.
+// Each file has its own queue and goroutine, so a slow file doesn't delay the others,
+// and the levels sharing a file keep their order. hook.lock is only held to find the queue.
+// The fatal and panic entries are never dropped, enqueue waits until they are written.
+// With QueueBlock, the entry is dropped and the ctx's error is returned if the ctx is done before
+// the queue has room, a nil ctx waits forever.
+func (hook *LfsHook) enqueue(ctx context.Context, e lfsEntry) error {
+	if e.level <= logrus.FatalLevel {
+		e.done = make(chan struct{})
+	}
+	for {
+		q := hook.queueGet(e)
+		sent, err := hook.queueSend(ctx, q, e)
+		if !sent {
+			// the queue was stopped by Close after queueGet, a new one is started.
+			continue
+		}
+		if err == nil && e.done != nil {
+			<-e.done
+		}
+		return err
+	}
+}
+
+// queueSend sends the entry to the queue by the QueuePolicy, it returns false if the queue is closed.
+func (hook *LfsHook) queueSend(ctx context.Context, q *lfsQueue, e lfsEntry) (bool, error) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return false, nil
+	}
+	if e.done != nil {
+		q.ch <- e
+		return true, nil
+	}
+	switch hook.QueuePolicy {
+	case QueueDropNewest:
+		select {
+		case q.ch <- e:
+		default:
+			atomic.AddUint64(&hook.stats.dropped, 1)
+		}
+	case QueueDropOldest:
+		for {
+			select {
+			case q.ch <- e:
+				return true, nil
+			default:
+			}
+			select {
+			case <-q.ch:
+				atomic.AddUint64(&hook.stats.dropped, 1)
+			default:
+			}
+		}
+	default:
+		if ctx == nil {
+			q.ch <- e
+			return true, nil
+		}
+		select {
+		case q.ch <- e:
+		case <-ctx.Done():
+			atomic.AddUint64(&hook.stats.dropped, 1)
+			return true, ctx.Err()
+		}
+	}
+	return true, nil
+}
+
+// queueLoop writes the queued entries until the queue is closed.
+// OnError and OnRotate are called by callLater, a callback logging to the full queue would block its drain.
+func (hook *LfsHook) queueLoop(q *lfsQueue) {
+	defer close(q.done)
+	for e := range q.ch {
+		rts, err := hook.fileWriteMsg(hook.fileFor(e.level, e.path, e.routed), e.level, e.msg, e.dup)
+		if err != nil {
+			hook.fallbackWrite(e.msg)
+		}
+		if e.done != nil {
+			close(e.done)
+		}
+		onRotate := hook.OnRotate
+		if err == nil && (onRotate == nil || len(rts) == 0) {
+			continue
+		}
+		level, entry := e.level, e.entry
+		hook.callLater(func() {
+			if err != nil {
+				hook.handleError(err, entry, "failed to write log file:")
+			}
+			if onRotate != nil {
+				for _, rt := range rts {
+					onRotate(level, rt.path, rt.name, rt.size)
+				}
+			}
+		})
+	}
+}
+
+// callLater queues f for callLoop, the callbacks run one by one in order.
+func (hook *LfsHook) callLater(f func()) {
+	hook.clk.Lock()
+	defer hook.clk.Unlock()
+	hook.calls = append(hook.calls, f)
+	if hook.cdone == nil {
+		hook.cdone = make(chan struct{})
+		go hook.callLoop(hook.cdone)
+	}
+}
+
+// callLoop runs the queued callbacks until there's none left, then closes done.
+func (hook *LfsHook) callLoop(done chan struct{}) {
+	defer close(done)
+	for {
+		hook.clk.Lock()
+		calls := hook.calls
+		hook.calls = nil
+		if len(calls) == 0 {
+			hook.cdone = nil
+			hook.clk.Unlock()
+			return
+		}
+		hook.clk.Unlock()
+		for _, f := range calls {
+			f()
+		}
+	}
+}
+
+// stopQueue closes the queues and waits for the queued entries to be written and their callbacks.
+func (hook *LfsHook) stopQueue() {
+	hook.lock.Lock()
+	queues := hook.queues
+	hook.queues = nil
+	hook.lock.Unlock()
+	for _, q := range queues {
+		q.mu.Lock()
+		q.closed = true
+		close(q.ch)
+		q.mu.Unlock()
+	}
+	for _, q := range queues {
+		<-q.done
+	}
+	// the callbacks of the written entries
+	hook.clk.Lock()
+	done := hook.cdone
+	hook.clk.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+// Dropped returns the count of the entries dropped by the QueuePolicy.
+func (hook *LfsHook) Dropped() uint64 {
+	return atomic.LoadUint64(&hook.stats.dropped)
+}
@@ -0,0 +1,108 @@
+package loglfshook
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// fileBakPattern returns the glob pattern matching the names produced by BackupNameFunc for the path.
+// The names of two distant times are compared, the differing middle part is matched by a wildcard.
+func (c *LfsHook) fileBakPattern(path string) string {
+	n1 := c.BackupNameFunc(path, time.Date(2001, 1, 1, 1, 1, 1, 0, time.UTC))
+	n2 := c.BackupNameFunc(path, time.Date(2112, 12, 22, 22, 22, 22, 0, time.UTC))
+	prefix, suffix := nameAffix(n1, n2)
+	return globEscape(prefix) + "*" + globEscape(suffix)
+}
+
+// nameAffix returns the common prefix and suffix of the names, not overlapping.
+func nameAffix(n1, n2 string) (string, string) {
+	i := 0
+	for i < len(n1) && i < len(n2) && n1[i] == n2[i] {
+		i++
+	}
+	j := 0
+	for j < len(n1)-i && j < len(n2)-i && n1[len(n1)-1-j] == n2[len(n2)-1-j] {
+		j++
+	}
+	return n1[:i], n1[len(n1)-j:]
+}
+func globEscape(s string) string {
+	return strings.NewReplacer("\\", "\\\\", "*", "\\*", "?", "\\?", "[", "\\[").Replace(s)
+}
+
+// fileBakMatches returns the backups of the path named by BackupNameFunc, the oldest first.
+func (c *LfsHook) fileBakMatches(path string) []fileBakInfo {
+	pattern := c.fileBakPattern(path)
+	names, _ := filepath.Glob(pattern)
+	// the compressed and the suffixed names, e.g. info-20240102-1504.log.1.gz
+	more, _ := filepath.Glob(pattern + ".*")
+	seen := make(map[string]bool)
+	var baks []fileBakInfo
+	for _, name := range append(names, more...) {
+		if seen[name] || name == path || strings.HasSuffix(name, manifestSuffix) {
+			continue
+		}
+		seen[name] = true
+		stat, err := os.Stat(name)
+		if err != nil || stat.IsDir() {
+			continue
+		}
+		baks = append(baks, fileBakInfo{FileInfo: stat, path: name})
+	}
+	sort.Slice(baks, func(i, j int) bool {
+		return baks[i].ModTime().Before(baks[j].ModTime())
+	})
+	return baks
+}
+
+// fileBakInfo is a backup found by fileBakMatches.
+type fileBakInfo struct {
+	os.FileInfo
+	path string
+}
+
+// fileBakTimed removes the stale and the oldest backups named by BackupNameFunc to keep room for a new one
+// and returns the name of the new backup, in UTC unless UseLocalTime is set.
+func (c *LfsHook) fileBakTimed(path string, backups int) string {
+	baks := c.fileBakMatches(path)
+	if c.MaxAge > 0 {
+		kept := baks[:0]
+		for _, bak := range baks {
+			if c.since(bak.ModTime()) > c.MaxAge {
+				os.Remove(bak.path)
+			} else {
+				kept = append(kept, bak)
+			}
+		}
+		baks = kept
+	}
+	for len(baks) > 0 && len(baks) >= backups {
+		os.Remove(baks[0].path)
+		baks = baks[1:]
+	}
+	if c.MaxTotalSize > 0 {
+		sizes := make([]int64, len(baks))
+		for i, bak := range baks {
+			sizes[i] = bak.Size()
+		}
+		for len(baks) > 0 && fileBakTotal(path, sizes) > c.MaxTotalSize {
+			os.Remove(baks[0].path)
+			baks, sizes = baks[1:], sizes[1:]
+		}
+	}
+
+	now := c.now()
+	if !c.UseLocalTime {
+		now = now.UTC()
+	}
+	base := c.BackupNameFunc(path, now)
+	name := base
+	for i := 1; fileExists(name) || fileExists(name+compressSuffix); i++ {
+		name = fmt.Sprintf("%s.%d", base, i)
+	}
+	return name
+}
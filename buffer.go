@@ -0,0 +1,70 @@
+package loglfshook
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"sync"
+	"unicode/utf8"
+)
+
+// maxPooledBuffer is the max capacity of a buffer put back to the pool, so a huge entry doesn't pin the memory.
+const maxPooledBuffer = 64 * 1024
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+func putBuffer(buf *bytes.Buffer) {
+	if buf != nil && buf.Cap() <= maxPooledBuffer {
+		bufferPool.Put(buf)
+	}
+}
+
+// truncateMsg truncates the msg longer than max bytes with a marker, the trailing newline is kept.
+// The msg is cut at a rune boundary.
+func truncateMsg(msg []byte, max int) []byte {
+	if max <= 0 || len(msg) <= max {
+		return msg
+	}
+	body, nl := msg, ""
+	if bytes.HasSuffix(body, []byte{'\n'}) {
+		body, nl = body[:len(body)-1], "\n"
+	}
+	if len(body) <= max {
+		return msg
+	}
+	keep := max
+	for keep > 0 && !utf8.RuneStart(body[keep]) {
+		keep--
+	}
+	return append(body[:keep:keep], fmt.Sprintf("...[truncated %d bytes]%s", len(body)-keep, nl)...)
+}
+
+// ensureNewline appends a newline to the msg if it doesn't end with one.
+func ensureNewline(msg []byte) []byte {
+	if len(msg) == 0 || msg[len(msg)-1] == '\n' {
+		return msg
+	}
+	return append(msg, '\n')
+}
+
+// formatEntry formats the entry into the buffer if the formatter writes to entry.Buffer like the logrus formatters,
+// the msg must not be used after the buffer is put back. A nil buffer formats into a new slice.
+func formatEntry(formatter logrus.Formatter, entry *logrus.Entry, buf *bytes.Buffer) ([]byte, error) {
+	if buf == nil || entry.Buffer != nil {
+		return formatter.Format(entry)
+	}
+	entry.Buffer = buf
+	defer func() {
+		entry.Buffer = nil
+	}()
+	return formatter.Format(entry)
+}
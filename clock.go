@@ -0,0 +1,30 @@
+package loglfshook
+
+import "time"
+
+// clock is the source of the current time, the tests replace it to check the time-based features.
+type clock interface {
+	Now() time.Time
+}
+
+// clockFunc adapts a func like time.Now to clock.
+type clockFunc func() time.Time
+
+func (f clockFunc) Now() time.Time {
+	return f()
+}
+
+// setClock replaces the wall clock of the hook, it must be called before the hook is used.
+// The clock is used for all the rotation decisions and the time placeholders of the paths.
+func (c *LfsHook) setClock(clk clock) {
+	c.clock = clk
+}
+func (c *LfsHook) now() time.Time {
+	if c.clock != nil {
+		return c.clock.Now()
+	}
+	return time.Now()
+}
+func (c *LfsHook) since(t time.Time) time.Duration {
+	return c.now().Sub(t)
+}
@@ -0,0 +1,118 @@
+package loglfshook
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+)
+
+// compressSuffix is appended to the rotated files when LfsHook.Compress is set.
+const compressSuffix = ".gz"
+
+// fileExists reports whether the path or its compressed variant exists.
+func fileExists(path string) bool {
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		return true
+	}
+	if _, err := os.Stat(path + compressSuffix); !os.IsNotExist(err) {
+		return true
+	}
+	return false
+}
+
+// fileCompress gzips the rotated file in background if compression is enabled.
+// It must be called with zlk held and releases it once the compression is done,
+// so the backups can not be moved while compressing.
+func (c *LfsHook) fileCompress(path string) {
+	if !c.Compress || c.CompressActive {
+		c.zlk.Unlock()
+		return
+	}
+	c.zwg.Add(1)
+	go func() {
+		err := gzipFile(path)
+		// the callback may log and rotate, which takes zlk, and Close waits for zwg under hook.lock
+		c.zlk.Unlock()
+		c.zwg.Done()
+		if err != nil {
+			c.handleError(err, nil, "failed to compress log file:")
+		}
+	}()
+}
+
+// gzipFile compresses the src to src.gz and removes the src once the result is synced.
+func gzipFile(src string) (rterr error) {
+	fl, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer fl.Close()
+	stat, err := fl.Stat()
+	if err != nil {
+		return err
+	}
+	dst := src + compressSuffix
+	fd, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0664)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if rterr != nil {
+			fd.Close()
+			os.Remove(dst)
+		}
+	}()
+	zw := gzip.NewWriter(fd)
+	if _, err = io.Copy(zw, fl); err != nil {
+		return err
+	}
+	if err = zw.Close(); err != nil {
+		return err
+	}
+	if err = fd.Sync(); err != nil {
+		return err
+	}
+	if err = fd.Close(); err != nil {
+		return err
+	}
+	// keep the modification time for MaxAge
+	os.Chtimes(dst, stat.ModTime(), stat.ModTime())
+	fl.Close()
+	return os.Remove(src)
+}
+
+// gzipSink writes the compressed data of CompressActive to the file, counting the compressed size.
+type gzipSink struct {
+	fe *lfsFile
+}
+
+func (s gzipSink) Write(p []byte) (int, error) {
+	var (
+		n   int
+		err error
+	)
+	if s.fe.bw != nil {
+		n, err = s.fe.bw.Write(p)
+	} else {
+		n, err = s.fe.fd.Write(p)
+	}
+	s.fe.ln += int64(n)
+	return n, err
+}
+
+// fileGzip starts a gzip member on the opened file for CompressActive, the caller must hold fe.lk.
+func (c *LfsHook) fileGzip(fe *lfsFile) {
+	if c.CompressActive {
+		fe.gz = gzip.NewWriter(gzipSink{fe: fe})
+	}
+}
+
+// closeGzip ends the gzip member writing its trailer, the caller must hold fe.lk.
+func (fe *lfsFile) closeGzip() error {
+	if fe.gz == nil {
+		return nil
+	}
+	err := fe.gz.Close()
+	fe.gz = nil
+	return err
+}
@@ -0,0 +1,64 @@
+package loglfshook
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+)
+
+// SetContext ties the hook to the context. When the context is canceled, the hook is closed,
+// see Close, and Fire stops writing and returns the context's error.
+func (hook *LfsHook) SetContext(ctx context.Context) {
+	hook.lock.Lock()
+	hook.ctx = ctx
+	hook.lock.Unlock()
+	hook.watchContext(ctx)
+}
+
+// FireContext is Fire giving up when the ctx is done, for the request-scoped loggers with a deadline.
+// It returns the ctx's error if the entry isn't written in time.
+// With QueueSize and QueueBlock, the entry waiting for room in the queue is dropped when the ctx is done.
+// Otherwise the entry is written in a goroutine, a write blocked in a system call can't be canceled,
+// so the entry may still be written after FireContext returns.
+func (hook *LfsHook) FireContext(ctx context.Context, entry *logrus.Entry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if hook.QueueSize > 0 {
+		return hook.fireContext(ctx, entry)
+	}
+	// the write may outlive the call, so it gets its own copy of the entry
+	entry = copyEntry(entry)
+	done := make(chan error, 1)
+	go func() {
+		done <- hook.fireContext(ctx, entry)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// watchContext closes the hook when the context is canceled.
+func (hook *LfsHook) watchContext(ctx context.Context) {
+	// the writes read the context without the lock
+	hook.ctxv.Store(ctxBox{ctx: ctx})
+	if ctx.Done() == nil {
+		return
+	}
+	go func() {
+		<-ctx.Done()
+		if err := hook.Close(); err != nil {
+			hook.handleError(err, nil, "failed to close log files:")
+		}
+	}()
+}
+
+// ctxErr returns the error of the hook's context, the caller must hold hook.lock.
+func (hook *LfsHook) ctxErr() error {
+	if hook.ctx == nil {
+		return nil
+	}
+	return hook.ctx.Err()
+}
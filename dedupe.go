@@ -0,0 +1,61 @@
+package loglfshook
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+)
+
+// lfsDup is an entry compared for DedupeConsecutive and the count of its suppressed duplicates.
+type lfsDup struct {
+	key       string
+	level     logrus.Level
+	logger    *logrus.Logger
+	formatter logrus.Formatter
+	repeats   int
+}
+
+// newDup returns the dup of the entry, the entry itself isn't kept because logrus reuses it.
+func newDup(entry *logrus.Entry, formatter logrus.Formatter) *lfsDup {
+	return &lfsDup{
+		key:       fmt.Sprintf("%s\x00%s\x00%v", entry.Level, entry.Message, entry.Data),
+		level:     entry.Level,
+		logger:    entry.Logger,
+		formatter: formatter,
+	}
+}
+
+// fileDedupe writes the summary of the duplicates of the last entry and remembers the new one,
+// the caller must hold fe.lk.
+func (hook *LfsHook) fileDedupe(fe *lfsFile, dup *lfsDup) {
+	if err := hook.dedupeFlush(fe); err != nil {
+		hook.fileError(fe, err, "failed to write log file:")
+	}
+	d := *dup
+	fe.dup = &d
+}
+
+// dedupeFlush writes the summary of the suppressed duplicates to the file if any, the caller must hold fe.lk.
+func (hook *LfsHook) dedupeFlush(fe *lfsFile) error {
+	d := fe.dup
+	fe.dup = nil
+	if d == nil || d.repeats <= 0 {
+		return nil
+	}
+	entry := logrus.NewEntry(d.logger)
+	entry.Time = hook.now()
+	entry.Level = d.level
+	entry.Message = fmt.Sprintf("last message repeated %d times", d.repeats)
+	msg, err := d.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	msg = hook.finishMsg(msg)
+	if fe.fd == nil {
+		if err := hook.fileCheck(fe, int64(len(msg))); err != nil {
+			return err
+		}
+	}
+	n, err := hook.fileAppend(fe, msg)
+	hook.stats.written(d.level, n, err)
+	return err
+}
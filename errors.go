@@ -0,0 +1,25 @@
+package loglfshook
+
+import "strings"
+
+// multiError combines several errors into one.
+type multiError []error
+
+func (e multiError) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// err returns nil if there is no error, the error itself if there is only one.
+func (e multiError) err() error {
+	switch len(e) {
+	case 0:
+		return nil
+	case 1:
+		return e[0]
+	}
+	return e
+}
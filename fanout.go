@@ -0,0 +1,20 @@
+package loglfshook
+
+import "io"
+
+// fanoutWriter writes to all the writers, unlike io.MultiWriter it doesn't stop at the first error.
+type fanoutWriter []io.Writer
+
+func (fw fanoutWriter) Write(p []byte) (int, error) {
+	var errs multiError
+	for _, w := range fw {
+		n, err := w.Write(p)
+		if err == nil && n < len(p) {
+			err = io.ErrShortWrite
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return len(p), errs.err()
+}
@@ -0,0 +1,48 @@
+package loglfshook
+
+import "github.com/sirupsen/logrus"
+
+// SetDefaultFields adds the fields to every entry written by the hook, e.g. the service and the host.
+// The fields set by the entry take precedence. The entry is cloned, so the other hooks don't see the fields.
+func (hook *LfsHook) SetDefaultFields(fields logrus.Fields) {
+	hook.lock.Lock()
+	defer hook.lock.Unlock()
+	hook.fields = copyFields(fields)
+}
+func copyFields(fields logrus.Fields) logrus.Fields {
+	if len(fields) <= 0 {
+		return nil
+	}
+	cp := make(logrus.Fields, len(fields))
+	for k, v := range fields {
+		cp[k] = v
+	}
+	return cp
+}
+
+// copyEntry returns a copy of the entry with its own fields, for keeping the entry reused by logrus after the hooks.
+func copyEntry(entry *logrus.Entry) *logrus.Entry {
+	clone := *entry
+	clone.Data = make(logrus.Fields, len(entry.Data))
+	for k, v := range entry.Data {
+		clone.Data[k] = v
+	}
+	clone.Buffer = nil
+	return &clone
+}
+
+// withDefaultFields returns a clone of the entry with the default fields merged, the entry itself is unchanged.
+func withDefaultFields(entry *logrus.Entry, fields logrus.Fields) *logrus.Entry {
+	if len(fields) <= 0 {
+		return entry
+	}
+	clone := *entry
+	clone.Data = make(logrus.Fields, len(entry.Data)+len(fields))
+	for k, v := range fields {
+		clone.Data[k] = v
+	}
+	for k, v := range entry.Data {
+		clone.Data[k] = v
+	}
+	return &clone
+}
@@ -0,0 +1,19 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package loglfshook
+
+import "os"
+
+// flockSupported reports whether the advisory locks are taken on this platform.
+const flockSupported = false
+
+// flock does nothing, the advisory locks are not supported on this platform.
+func flock(fl *os.File) error {
+	return nil
+}
+
+// funlock does nothing, the advisory locks are not supported on this platform.
+func funlock(fl *os.File) error {
+	return nil
+}
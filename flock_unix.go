@@ -0,0 +1,27 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package loglfshook
+
+import (
+	"os"
+	"syscall"
+)
+
+// flockSupported reports whether the advisory locks are taken on this platform.
+const flockSupported = true
+
+// flock takes the exclusive advisory lock of the file, waiting for the other processes.
+func flock(fl *os.File) error {
+	for {
+		err := syscall.Flock(int(fl.Fd()), syscall.LOCK_EX)
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
+
+// funlock releases the advisory lock of the file.
+func funlock(fl *os.File) error {
+	return syscall.Flock(int(fl.Fd()), syscall.LOCK_UN)
+}
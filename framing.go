@@ -0,0 +1,28 @@
+package loglfshook
+
+import "encoding/binary"
+
+// Framing decides how the formatted entries are delimited in the output.
+type Framing int
+
+const (
+	// FramingNone writes the formatted entries as is.
+	FramingNone Framing = iota
+	// FramingLengthPrefix prefixes each formatted entry with its length as a 4-byte big-endian integer,
+	// so the readers can split the entries even if they contain newlines.
+	FramingLengthPrefix
+)
+
+// frameLengthSize is the size of the length prefix of FramingLengthPrefix.
+const frameLengthSize = 4
+
+// frameMsg returns the msg framed by the Framing, the msg itself is unchanged.
+func frameMsg(msg []byte, framing Framing) []byte {
+	if framing != FramingLengthPrefix {
+		return msg
+	}
+	framed := make([]byte, frameLengthSize+len(msg))
+	binary.BigEndian.PutUint32(framed, uint32(len(msg)))
+	copy(framed[frameLengthSize:], msg)
+	return framed
+}
@@ -0,0 +1,71 @@
+package loglfshook
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"sync/atomic"
+)
+
+// levelWriter writes the bytes to the file of a level, see WriterFor.
+type levelWriter struct {
+	hook   *LfsHook
+	level  logrus.Level
+	closed int32
+}
+
+// WriterFor returns a writer of the file of the level, e.g. for the standard log package or an HTTP access logger.
+// The bytes are written as is without the formatter, and the file is rotated like the entries of the level.
+// Each Write is written at once, bypassing the queue. The file is shared with the entries of the level,
+// Close only stops the writer, the file is closed by LfsHook.Close. The writes fail if the level has no file.
+// Like Fire, the writes are discarded if the level is left out by SetLevels, and dropped while paused
+// by Pause, as the bytes can't be kept with the entries for Resume.
+func (hook *LfsHook) WriterFor(level logrus.Level) io.WriteCloser {
+	return &levelWriter{hook: hook, level: level}
+}
+
+func (w *levelWriter) Write(p []byte) (int, error) {
+	if atomic.LoadInt32(&w.closed) != 0 {
+		return 0, os.ErrClosed
+	}
+	hook := w.hook
+	if atomic.LoadInt32(&hook.paused) != 0 {
+		atomic.AddUint64(&hook.stats.dropped, 1)
+		return len(p), nil
+	}
+	hook.lock.Lock()
+	if err := hook.ctxErr(); err != nil {
+		hook.lock.Unlock()
+		return 0, err
+	}
+	if hook.hasLevels && !hook.hasLevel(w.level) {
+		hook.lock.Unlock()
+		return len(p), nil
+	}
+	path, ok := hook.filePath(w.level)
+	if ok {
+		hook.startTicks()
+	}
+	onRotate := hook.OnRotate
+	hook.lock.Unlock()
+	if !ok {
+		return 0, fmt.Errorf("no log file for level %s", w.level)
+	}
+
+	rts, err := hook.fileWriteMsg(hook.fileGet(w.level, path), w.level, p, nil)
+	if onRotate != nil {
+		for _, rt := range rts {
+			onRotate(w.level, rt.path, rt.name, rt.size)
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *levelWriter) Close() error {
+	atomic.StoreInt32(&w.closed, 1)
+	return nil
+}
@@ -2,71 +2,471 @@
 package loglfshook
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
 	"fmt"
 	"github.com/sirupsen/logrus"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
 	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// reopenCheckInterval is the default min interval to check the path for ReopenOnChange.
+const reopenCheckInterval = time.Second
+
 // We are logging to file, strip colors to make the output more readable.
 var defaultFormatter = &logrus.TextFormatter{DisableColors: true}
 
 // PathMap is map for mapping a log level to a file's path.
 // Multiple levels may share a file, but multiple files may not be used for one level.
+// The path may contain the %Y, %m, %d, %H and %M placeholders, e.g. logs/app-%Y-%m-%d.log,
+// which are expanded when the file is opened, so a new file is created once the expanded path changes.
+// The size-based backups are numbered per expanded file, e.g. logs/app-2024-01-15.log.1.
 type PathMap map[logrus.Level]string
 
+// LevelDir is a directory for writing each level to its own file named by the level, e.g. logs/info.log.
+type LevelDir string
+
+// FormatterMap is map for mapping a log level to a formatter.
+type FormatterMap map[logrus.Level]logrus.Formatter
+
 // WriterMap is map for mapping a log level to an io.Writer.
-// Multiple levels may share a writer, but multiple writers may not be used for one level.
+// Multiple levels may share a writer, but multiple writers may not be used for one level, see MultiWriterMap.
 type WriterMap map[logrus.Level]io.Writer
 
-// LfsHook is a hook to handle writing to local log files.
+// MultiWriterMap is map for mapping a log level to multiple io.Writers.
+// The entry is written to all the writers of the level even if some of them fail.
+type MultiWriterMap map[logrus.Level][]io.Writer
+
+// lfsFile is a log file opened for a level.
 type lfsFile struct {
 	lk   sync.Mutex
 	fd   *os.File
+	bw   *bufio.Writer
 	path string
 	ln   int64
+	hd   int64
+	// lines is the count of the lines written since the file was opened, the header isn't counted.
+	lines int64
+	// writes is the count of the writes since the size was checked by SizeCheckWrites.
+	writes int
+	day    time.Time
+	tmpl   string
+
+	openedAt  time.Time
+	checkedAt time.Time
+	rotatedAt time.Time
+	firstAt   time.Time
+	lastAt    time.Time
+
+	rts []lfsRotation
+	// errs are the errors found under lk, passed to OnError once it's released.
+	errs []lfsError
+	// closed is set by Close, the file is replaced by a new one in hook.fls.
+	closed bool
+	// level is the first level written to the file, the file may be shared by the levels of the same path.
+	level logrus.Level
+	// routed files are keyed by path in hook.routes, see SetFieldRoute.
+	routed bool
+	usedAt time.Time
+	// dup is the last entry written for DedupeConsecutive.
+	dup *lfsDup
+	// lkf is the lock file of MultiProcess.
+	lkf *os.File
+	// limits are the limits of the level resolved at the generation lgen, if limited.
+	limits  lfsLimits
+	lgen    uint32
+	limited bool
+	// gz compresses the writes for CompressActive.
+	gz *gzip.Writer
+}
+
+// lfsRotation is a rotation waiting for the OnRotate callback.
+type lfsRotation struct {
+	path string
+	name string
+	size int64
+}
+
+// lfsError is an error waiting for handleError, msg is printed with it if OnError is nil.
+type lfsError struct {
+	err   error
+	entry *logrus.Entry
+	msg   string
+}
+
+func (fe *lfsFile) writer() io.Writer {
+	if fe.gz != nil {
+		return fe.gz
+	}
+	if fe.bw != nil {
+		return fe.bw
+	}
+	return fe.fd
+}
+func (fe *lfsFile) flush() error {
+	var err error
+	if fe.gz != nil {
+		err = fe.gz.Flush()
+	}
+	if fe.bw != nil {
+		if e := fe.bw.Flush(); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+func (fe *lfsFile) sync() error {
+	err := fe.flush()
+	if fe.fd != nil {
+		if e := fe.fd.Sync(); err == nil {
+			err = e
+		}
+	}
+	return err
 }
+func (fe *lfsFile) close() error {
+	err := fe.closeGzip()
+	if e := fe.flush(); err == nil {
+		err = e
+	}
+	fe.bw = nil
+	if fe.fd != nil {
+		if e := fe.fd.Close(); err == nil {
+			err = e
+		}
+		fe.fd = nil
+	}
+	return err
+}
+
+// LfsHook is a hook to handle writing to local log files or writers.
+// The methods are safe for concurrent use, the PathMap and WriterMap given to the constructor are copied,
+// so they should be changed with AddPath and AddWriter at runtime.
+// The exported fields must be set before the hook is used and not changed afterward.
 type LfsHook struct {
+	stats lfsStats
+
 	paths     PathMap
 	writers   WriterMap
 	levels    []logrus.Level
+	hasLevels bool
 	lock      *sync.Mutex
 	formatter logrus.Formatter
 
+	formatters FormatterMap
+
 	defaultPath      string
+	levelDir         string
+	combinedPath     string
+	fields           logrus.Fields
+	wstates          map[RotatingWriter]*lfsWriterState
+	sampler          *lfsSampler
+	syslog           SyslogWriter
+	threshold        bool
 	defaultWriter    io.Writer
 	hasDefaultPath   bool
 	hasDefaultWriter bool
 
-	FdMaxLen  int
+	// FdMaxLen is the max count of the numbered backups of a log file, see SetMaxBackups to change it at runtime.
+	FdMaxLen int
+	// FdMaxSize is the max size of a log file. The file is rotated before a write that would exceed it,
+	// so a file only overshoots when a single entry is larger than FdMaxSize, which is written to its own file.
+	// Zero or a negative size disables the size-based rotation. See SetMaxSize to change it at runtime.
 	FdMaxSize int64
+	// SizeMap and LenMap override FdMaxSize and FdMaxLen for the files of the levels, e.g. a smaller
+	// debug.log than error.log. They must be set before the hook is used, see SetLevelLimits to change them later.
+	// A file shared by several levels uses the limits of the level first writing to it.
+	SizeMap map[logrus.Level]int64
+	LenMap  map[logrus.Level]int
+	// MaxLines rotates the log files once they have the given count of lines, whichever of
+	// FdMaxSize and MaxLines is hit first triggers the rotation. Zero disables line-based rotation.
+	// The lines are counted since the file is opened, the existing lines of a reopened file aren't counted.
+	MaxLines int64
+	// RotateDaily rotates the log files at local midnight regardless of size.
+	// The rotated file is named with a date stamp, e.g. info.log-2024-01-02.
+	// When FdMaxSize is also set, files still rotate by size within a day using
+	// the .1, .2... suffixes; only the active file is renamed at midnight.
+	RotateDaily bool
+	// RotationInterval rotates the log files once they have been open for the given duration.
+	// The rotated files use the same .1, .2... backup numbering as size-based rotation.
+	// Zero disables time-based rotation.
+	RotationInterval time.Duration
+	// RotateMode decides how the active file is moved to the backup, RotateRename by default.
+	// With RotateCopyTruncate the file is truncated in place and kept open, for the log shippers holding
+	// the file open; the copy costs a read and a write of the whole file on each rotation.
+	RotateMode RotateMode
+	// MinRotateInterval prevents rotating a file by size, lines or interval more often than once per the given
+	// duration, so a burst of large entries doesn't churn through all the backups. The entries are written to
+	// the current file until the interval elapses, so the file may grow beyond FdMaxSize meanwhile:
+	// it trades the accuracy of the size cap for the retention of the backups. Zero rotates as soon as needed.
+	MinRotateInterval time.Duration
+	// Compress gzips the rotated files in background, e.g. info.log.1.gz.
+	// The active log file is never compressed unless CompressActive is set, the backups aren't compressed again then.
+	Compress bool
+	// CompressActive gzips the active log files as they're written, the paths should end with ".gz".
+	// The compressed data is flushed after each entry, or each FlushInterval if set for a better ratio.
+	// The sizes for FdMaxSize are the compressed sizes. The gzip trailer is written on Close, Reopen and rotation,
+	// a reopened file gets a new gzip member appended, which the gzip readers read as one stream.
+	// It can't be used with MultiProcess, as the members of the processes would interleave.
+	CompressActive bool
+	// MaxAge removes the rotated files whose modification time is older than the given duration.
+	// Both the numbered and the date-stamped backups are checked after each rotation, and in background
+	// once per MaxAge or hour, whichever is shorter, so an idle hook removes them too. The background check
+	// only covers the files opened since the last Close and is skipped with a custom Rotator.
+	// Other files in the directory are never removed.
+	// It works together with FdMaxLen, so whichever trims more wins. Zero keeps the files by count only.
+	MaxAge time.Duration
+	// MaxTotalSize removes the oldest backups on rotation until the sizes of the backups plus the rotated file
+	// are within the given bytes, the compressed backups are counted by their compressed sizes.
+	// It works together with FdMaxLen and MaxAge, the newest backup is always kept. The date-stamped backups
+	// of RotateDaily aren't counted. Zero disables the limit.
+	MaxTotalSize int64
+	// BackupNameFunc names the rotated files instead of the .1, .2... numbering, e.g. info-20240102-1504.log.
+	// t is the rotation time in UTC unless UseLocalTime is set, a .1, .2... suffix is added if the name exists.
+	// The existing backups are found by the name pattern, the oldest are removed to keep FdMaxLen.
+	BackupNameFunc func(path string, t time.Time) string
+	// BackupIndexName names the numbered backups, e.g. app-000001.log, DefaultBackupIndexName is used if nil.
+	// The name must contain the decimal index, it's used to find and renumber the existing backups.
+	BackupIndexName func(path string, index int) string
+	// UseLocalTime passes the local time instead of UTC to BackupNameFunc.
+	UseLocalTime bool
+	// BufferSize enables buffered writes with the given buffer size. Zero writes each entry directly.
+	// The buffered entries are written on Flush, Close and rotation; fatal and panic entries are flushed immediately.
+	BufferSize int
+	// FlushInterval flushes the buffered writes periodically in background when BufferSize or CompressActive is set.
+	FlushInterval time.Duration
+	// SyncInterval flushes and fsyncs the opened files periodically in background, so a crash loses
+	// the entries of one interval at most. The errors are passed to OnError. Zero leaves it to the OS.
+	SyncInterval time.Duration
+	// SyncOnWrite flushes and fsyncs the file after each write, so the entry is on the disk when Fire returns,
+	// e.g. for the audit logs. It's slow, each write waits for the disk, typically by milliseconds.
+	SyncOnWrite bool
+	// CloseWriters closes the writers implementing io.Closer on Close, including the default writer.
+	// The writers that don't implement io.Closer are skipped. The hook can not write to the closed writers anymore.
+	CloseWriters bool
+	// FileMode is the permission used to create the log files, 0664 by default.
+	// The pre-existing files keep their mode.
+	FileMode os.FileMode
+	// DirMode is the permission used to create the log directories, 0755 by default.
+	DirMode os.FileMode
+	// QueueSize enables the asynchronous mode, Fire only queues the formatted entries
+	// and a background goroutine per file writes them to the files. The routed files of SetFieldRoute
+	// share one goroutine. Zero writes synchronously.
+	// The queued entries are written before Close returns.
+	QueueSize int
+	// QueuePolicy decides what to do when the queue is full, QueueBlock by default.
+	QueuePolicy QueuePolicy
+	// ReopenOnChange reopens the log file if the path no longer refers to the opened file,
+	// e.g. it's moved or removed by logrotate. The path is checked before writing,
+	// once per ReopenCheckInterval at most, and in background every ReopenCheckInterval,
+	// so the file removed while the hook is idle is recreated too.
+	ReopenOnChange bool
+	// ReopenCheckInterval is the min interval to check the path for ReopenOnChange, one second by default.
+	ReopenCheckInterval time.Duration
+	// SizeCheckWrites reads the file's size from the disk every given count of writes, instead of only
+	// counting the bytes written by the hook. It's for several processes or hooks writing the same path,
+	// together with ReopenOnChange so the file rotated by another writer is reopened.
+	// Without it, the size is only counted in memory and multi-process writing to one path is unsupported.
+	SizeCheckWrites int
+	// MaxRouteFiles is the max count of the opened files routed by SetFieldRoute, 64 by default.
+	// The least recently used file is closed when the limit is reached.
+	MaxRouteFiles int
+	// Symlink keeps a symlink pointing to the active log file, the link name is the configured path
+	// with the extension replaced by Symlink, e.g. info.log -> info.current with ".current".
+	// The time placeholders are removed from the link name with their leading separator, so the link
+	// keeps a fixed path, e.g. logs/%Y/app-%Y-%m-%d.log -> logs/app.current.
+	// The link is updated atomically whenever a file is opened, it is skipped if symlinks are not supported.
+	Symlink string
+	// FileHeader returns the header written to each newly created file, including the rotated ones.
+	// The header counts toward FdMaxSize, a file holding only the header is never rotated.
+	// An existing non-empty file reopened for append doesn't get the header again.
+	FileHeader func() []byte
+	// Manifest appends a ManifestRecord as a JSON line to path.manifest.jsonl on each rotation,
+	// so the completed files can be discovered by the log shipping tools.
+	Manifest bool
+	// Rotator decides when and how the log files are rotated, DefaultRotator is used if nil.
+	// The daily rotation by RotateDaily is done regardless of the Rotator.
+	Rotator Rotator
+	// MaxLineBytes truncates the formatted entries longer than the given bytes, with a marker like
+	// "...[truncated 123 bytes]" before the trailing newline. Zero writes the entries as is.
+	MaxLineBytes int
+	// EnsureNewline appends a newline to the formatted entries not ending with one,
+	// for the formatters which don't add it.
+	EnsureNewline bool
+	// Truncate empties each log file when it's first opened by the hook, so each run of the process
+	// starts clean files. The files reopened afterward, e.g. after a rotation or Close, are appended to.
+	Truncate bool
+	// OpenFlags are OR'd into the flags opening the log files, e.g. os.O_SYNC so each write reaches
+	// the disk before returning, trading the throughput for the durability.
+	// O_CREATE and O_APPEND are always set and O_TRUNC and O_EXCL are ignored, the access mode is O_RDWR if not given.
+	OpenFlags int
+	// MultiProcess coordinates the processes writing the same files by an advisory lock (flock) on a lock
+	// file next to each log file, named with the ".lock" suffix. The lock is held while checking, rotating
+	// and writing an entry, and the file size is reloaded under the lock, so the entries of the processes
+	// don't interleave and their rotations don't clobber each other. Each write then costs a few system
+	// calls, and BufferSize only batches the bytes of a single entry, as the buffer is flushed before unlocking.
+	// It does nothing on the platforms without flock.
+	MultiProcess bool
+	// Framing delimits the formatted entries, e.g. FramingLengthPrefix for the binary transports.
+	// The length prefix counts toward FdMaxSize and the written bytes. The FileHeader is framed too,
+	// so the files can be read as frames from the start.
+	Framing Framing
+	// WriteRetries retries the writes failing with a transient error such as EAGAIN, EINTR or EIO
+	// up to the given times, the other errors fail at once. The retries are counted in Stats.Retries.
+	// The buffered writes of BufferSize and CompressActive aren't retried, as the buffers keep failing.
+	// The writers are written under the lock, so a retrying writer delays the other entries.
+	WriteRetries int
+	// RetryBackoff is the wait before the first retry of WriteRetries, doubled after each retry.
+	// The wait is cut short when the context of SetContext is done.
+	RetryBackoff time.Duration
+	// RawMode writes the message of the entry with a trailing newline instead of formatting it,
+	// for the messages formatted elsewhere. The formatters and the fields of the entry are ignored.
+	RawMode bool
+	// DedupeConsecutive collapses the consecutive duplicates written to a file, they are counted instead,
+	// and a "last message repeated N times" entry is written before the next different entry or on Close.
+	// The entries are duplicates if they have the same level, message and fields.
+	DedupeConsecutive bool
+	// PauseBuffer is the max count of the entries kept while paused by Pause, they are written on Resume.
+	// Zero drops all the entries while paused.
+	PauseBuffer int
+	// FallbackWriter receives the entries failed to be written to their files, e.g. os.Stderr,
+	// so the entries aren't lost when the disk is full or the directory is unwritable.
+	// The error of the file write is still returned.
+	FallbackWriter io.Writer
+	// OnError is called for the format, open and write errors instead of printing them to the standard logger.
+	// The entry is nil for the errors in background, e.g. compressing or flushing.
+	// The errors found under the hook's locks, e.g. failed rotations or writer errors, are reported
+	// once they're released, so it's safe to log inside the callback.
+	OnError func(err error, entry *logrus.Entry)
+	// OnRotate is called after a log file of the level is rotated from oldPath to newPath,
+	// size is the final size of the rotated file. It is called outside the hook's locks,
+	// so it's safe to log inside the callback.
+	OnRotate func(level logrus.Level, oldPath, newPath string, size int64)
+	// OnRotateUpload is called in background with the final path of each rotated file, after compressing
+	// if Compress is set, e.g. to upload it to S3. The files are uploaded one by one, a slow or failing
+	// uploader never blocks logging: the errors are passed to OnError and the files are skipped once
+	// 64 are waiting. Removing the uploaded files is the uploader's responsibility. The numbered backups
+	// may be renumbered by the later rotations, use BackupNameFunc for the stable names.
+	OnRotateUpload func(path string) error
 
-	flk sync.Mutex
-	fls map[logrus.Level]*lfsFile
+	flk    sync.Mutex
+	fls    map[string]*lfsFile
+	routes map[string]*lfsFile
+
+	routeField string
+	routeFunc  func(value string) string
+
+	// slk guards FdMaxSize, FdMaxLen and the limits changed at runtime, it's taken after all the other locks.
+	slk    sync.RWMutex
+	limits map[logrus.Level]lfsLimits
+	// lgen is the generation of the limits, incremented atomically under slk when they're changed
+	lgen uint32
+	// wlk serializes the writes to FallbackWriter
+	wlk sync.Mutex
+	zlk sync.Mutex
+	ulk sync.Mutex
+	uwg sync.WaitGroup
+	zwg sync.WaitGroup
+	// mlk guards the manifest writes and mlast, closed once the last deferred record is written
+	mlk   sync.Mutex
+	mlast chan struct{}
+
+	clock clock
+	// plk guards the entries kept while paused
+	plk    sync.Mutex
+	paused int32
+	kept   []*logrus.Entry
+
+	// rates and ticks are the 1 of n sampling of each level, updated atomically
+	rates [logrus.TraceLevel + 1]uint32
+	ticks [logrus.TraceLevel + 1]uint32
+
+	// warned is the warning of the levels without output, reported once
+	warned [logrus.TraceLevel + 1]sync.Once
+
+	// truncated is the set of the paths already opened with Truncate
+	truncated sync.Map
+
+	fstop chan struct{}
+	sstop chan struct{}
+	astop chan struct{}
+	rstop chan struct{}
+	ctx   context.Context
+	ctxv  atomic.Value
+
+	queues  map[lfsQueueKey]*lfsQueue
+	uploads chan string
+
+	// clk guards the callbacks of the queued writes waiting for callLoop, cdone is closed once it's idle
+	clk   sync.Mutex
+	calls []func()
+	cdone chan struct{}
 }
 
 // NewHook returns new LFS hook.
-// Output can be a string, io.Writer, WriterMap or PathMap.
-// If using io.Writer or WriterMap, user is responsible for closing the used io.Writer.
+// Output can be a string, io.Writer, WriterMap, MultiWriterMap, PathMap or LevelDir.
+// If using io.Writer, WriterMap or MultiWriterMap, user is responsible for closing the used io.Writer,
+// unless LfsHook.CloseWriters is set. The writers implementing RotatingWriter are rotated like the files.
+// The files and the writers can be combined by SetDefaultPath and SetDefaultWriter, each entry is written to both.
+// The optional maxsz are the max file size and the max backup file count.
+// It panics if the output type is unsupported, see NewLfsHookE.
 func NewLfsHook(output interface{}, formatter logrus.Formatter, maxsz ...int64) *LfsHook {
-	hook := &LfsHook{
-		lock:      new(sync.Mutex),
-		FdMaxLen:  10,
-		FdMaxSize: 1024 * 1024 * 10,
-		fls:       make(map[logrus.Level]*lfsFile),
+	hook, err := NewLfsHookE(output, formatter, maxsz...)
+	if err != nil {
+		panic(err.Error())
 	}
+	return hook
+}
+
+// NewJSONLfsHook is like NewLfsHook with a logrus.JSONFormatter writing each entry on a single line,
+// for the line-oriented tools parsing JSON lines.
+func NewJSONLfsHook(output interface{}, maxsz ...int64) *LfsHook {
+	return NewLfsHook(output, &logrus.JSONFormatter{PrettyPrint: false}, maxsz...)
+}
+
+// NewLfsHookE is like NewLfsHook but returns an error if the output type is unsupported.
+func NewLfsHookE(output interface{}, formatter logrus.Formatter, maxsz ...int64) (*LfsHook, error) {
+	opts := []Option{WithFormatter(formatter)}
 	if len(maxsz) > 0 && maxsz[0] > 0 {
-		hook.FdMaxSize = maxsz[0]
+		opts = append(opts, WithMaxSize(maxsz[0]))
 	}
 	if len(maxsz) > 1 && maxsz[1] > 0 {
-		hook.FdMaxLen = int(maxsz[1])
+		opts = append(opts, WithMaxBackups(int(maxsz[1])))
 	}
+	return NewLfsHookWithOptions(output, opts...)
+}
+
+// NewLfsHookWithOptions returns new LFS hook configured by the options.
+// Output can be a string, io.Writer, WriterMap, MultiWriterMap, PathMap or LevelDir, an error is returned for other types,
+// or if a level of the maps has an empty path or a nil writer.
+func NewLfsHookWithOptions(output interface{}, opts ...Option) (*LfsHook, error) {
+	hook := &LfsHook{
+		lock:      new(sync.Mutex),
+		FdMaxLen:  10,
+		FdMaxSize: 1024 * 1024 * 10,
+		FileMode:  0664,
+		DirMode:   0755,
 
-	hook.SetFormatter(formatter)
+		MaxRouteFiles: 64,
+		fls:           make(map[string]*lfsFile),
+	}
+	hook.SetFormatter(nil)
+	for _, opt := range opts {
+		opt(hook)
+	}
 
 	switch output.(type) {
 	case string:
@@ -75,41 +475,220 @@ func NewLfsHook(output interface{}, formatter logrus.Formatter, maxsz ...int64)
 	case io.Writer:
 		hook.SetDefaultWriter(output.(io.Writer))
 		break
+	case LevelDir:
+		hook.SetLevelDir(string(output.(LevelDir)))
+		break
 	case PathMap:
-		hook.paths = output.(PathMap)
-		for level := range output.(PathMap) {
-			hook.levels = append(hook.levels, level)
+		hook.paths = make(PathMap)
+		for level, path := range output.(PathMap) {
+			if path == "" {
+				return nil, fmt.Errorf("empty path for level %s", level)
+			}
+			hook.AddPath(level, path)
 		}
 		break
 	case WriterMap:
-		hook.writers = output.(WriterMap)
-		for level := range output.(WriterMap) {
-			hook.levels = append(hook.levels, level)
+		hook.writers = make(WriterMap)
+		for level, writer := range output.(WriterMap) {
+			if writer == nil {
+				return nil, fmt.Errorf("nil writer for level %s", level)
+			}
+			hook.AddWriter(level, writer)
+		}
+		break
+	case MultiWriterMap:
+		hook.writers = make(WriterMap)
+		for level, writers := range output.(MultiWriterMap) {
+			for _, writer := range writers {
+				if writer == nil {
+					return nil, fmt.Errorf("nil writer for level %s", level)
+				}
+			}
+			hook.AddWriter(level, fanoutWriter(writers))
 		}
 		break
 	default:
-		panic(fmt.Sprintf("unsupported level map type: %v", reflect.TypeOf(output)))
+		return nil, fmt.Errorf("unsupported level map type: %v", reflect.TypeOf(output))
+	}
+	if hook.ctx != nil {
+		hook.watchContext(hook.ctx)
 	}
 
-	return hook
+	return hook, nil
 }
 
 // SetFormatter sets the format that will be used by hook.
 // If using text formatter, this method will disable color output to make the log file more readable.
+// The text formatter is cloned, so the caller's formatter is left untouched.
 func (hook *LfsHook) SetFormatter(formatter logrus.Formatter) {
 	hook.lock.Lock()
 	defer hook.lock.Unlock()
 	if formatter == nil {
 		formatter = defaultFormatter
-	} else {
-		switch formatter.(type) {
-		case *logrus.TextFormatter:
-			textFormatter := formatter.(*logrus.TextFormatter)
-			textFormatter.DisableColors = true
+	}
+
+	hook.formatter = stripColors(formatter)
+}
+
+// SetLevelFormatter sets the format that will be used for the level instead of the hook's formatter.
+// The text formatter is handled like SetFormatter. A nil formatter removes the level's formatter.
+func (hook *LfsHook) SetLevelFormatter(level logrus.Level, formatter logrus.Formatter) {
+	hook.lock.Lock()
+	defer hook.lock.Unlock()
+	if formatter == nil {
+		delete(hook.formatters, level)
+		return
+	}
+	if hook.formatters == nil {
+		hook.formatters = make(FormatterMap)
+	}
+	hook.formatters[level] = stripColors(formatter)
+}
+
+// levelFormatter returns the formatter of the level, the caller must hold hook.lock.
+func (hook *LfsHook) levelFormatter(level logrus.Level) logrus.Formatter {
+	if hook.RawMode {
+		return rawFormatter{}
+	}
+	if formatter, ok := hook.formatters[level]; ok {
+		return formatter
+	}
+	return hook.formatter
+}
+
+// stripColors returns a clone of the text formatter with colors disabled, other formatters are returned as is.
+func stripColors(formatter logrus.Formatter) logrus.Formatter {
+	switch formatter.(type) {
+	case *logrus.TextFormatter:
+		textFormatter := cloneTextFormatter(formatter.(*logrus.TextFormatter))
+		textFormatter.DisableColors = true
+		return textFormatter
+	}
+	return formatter
+}
+
+// cloneTextFormatter copies the exported options of the text formatter.
+// The struct can not be copied directly because it holds a sync.Once.
+func cloneTextFormatter(f *logrus.TextFormatter) *logrus.TextFormatter {
+	return &logrus.TextFormatter{
+		ForceColors:               f.ForceColors,
+		DisableColors:             f.DisableColors,
+		ForceQuote:                f.ForceQuote,
+		DisableQuote:              f.DisableQuote,
+		EnvironmentOverrideColors: f.EnvironmentOverrideColors,
+		DisableTimestamp:          f.DisableTimestamp,
+		FullTimestamp:             f.FullTimestamp,
+		TimestampFormat:           f.TimestampFormat,
+		DisableSorting:            f.DisableSorting,
+		SortingFunc:               f.SortingFunc,
+		DisableLevelTruncation:    f.DisableLevelTruncation,
+		PadLevelText:              f.PadLevelText,
+		QuoteEmptyFields:          f.QuoteEmptyFields,
+		FieldMap:                  f.FieldMap,
+		CallerPrettyfier:          f.CallerPrettyfier,
+	}
+}
+
+// rawFormatter writes the message as is with a trailing newline, for RawMode.
+type rawFormatter struct{}
+
+func (rawFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	b := entry.Buffer
+	if b == nil {
+		b = &bytes.Buffer{}
+	}
+	b.WriteString(strings.TrimSuffix(entry.Message, "\n"))
+	b.WriteByte('\n')
+	return b.Bytes(), nil
+}
+
+// AddPath sets the file's path of the level at runtime, the opened file of the old path is closed
+// and the new path is used on the next Fire.
+func (hook *LfsHook) AddPath(level logrus.Level, path string) {
+	hook.handleErrors(hook.addPath(level, path))
+}
+
+// addPath sets the path of the level and closes the old file, it returns the errors closing it.
+func (hook *LfsHook) addPath(level logrus.Level, path string) []lfsError {
+	hook.lock.Lock()
+	defer hook.lock.Unlock()
+	if hook.paths == nil {
+		hook.paths = make(PathMap)
+	}
+	old, ok := hook.paths[level]
+	hook.paths[level] = path
+	hook.addLevel(level)
+	if !ok || old == path {
+		return nil
+	}
+
+	// the levels sharing the old file reopen it on the next Fire
+	hook.flk.Lock()
+	defer hook.flk.Unlock()
+	fe, ok := hook.fls[old]
+	if !ok {
+		return nil
+	}
+	fe.lk.Lock()
+	defer fe.lk.Unlock()
+	if err := hook.dedupeFlush(fe); err != nil {
+		hook.fileError(fe, err, "failed to write log file:")
+	}
+	if err := fe.close(); err != nil {
+		hook.fileError(fe, err, "failed to close log file:")
+	}
+	fe.release()
+	fe.closed = true
+	delete(hook.fls, old)
+	errs := fe.errs
+	fe.errs = nil
+	return errs
+}
+
+// AddWriter sets the writer of the level at runtime.
+func (hook *LfsHook) AddWriter(level logrus.Level, writer io.Writer) {
+	hook.lock.Lock()
+	defer hook.lock.Unlock()
+	if hook.writers == nil {
+		hook.writers = make(WriterMap)
+	}
+	hook.writers[level] = writer
+	hook.addLevel(level)
+}
+
+// addLevel adds the level to the configured levels, the caller must hold hook.lock.
+func (hook *LfsHook) addLevel(level logrus.Level) {
+	if !hook.hasLevels && !hook.hasLevel(level) {
+		hook.levels = append(hook.levels, level)
+	}
+}
+
+// hasLevel reports whether the level is in the configured levels, the caller must hold hook.lock.
+func (hook *LfsHook) hasLevel(level logrus.Level) bool {
+	for _, lv := range hook.levels {
+		if lv == level {
+			return true
 		}
 	}
+	return false
+}
+
+// SetThreshold makes the path or the writer of a level receive the more severe levels too,
+// e.g. the path of WarnLevel receives Warn, Error, Fatal and Panic.
+// An entry is written once, to the nearest level configured at or below its severity,
+// so with the paths of WarnLevel and ErrorLevel, the error entries are only written to the latter.
+func (hook *LfsHook) SetThreshold(threshold bool) {
+	hook.lock.Lock()
+	defer hook.lock.Unlock()
+	hook.threshold = threshold
+}
 
-	hook.formatter = formatter
+// SetLevelDir writes the levels without a defined output path to the files named by the level in the dir,
+// e.g. logs/info.log and logs/error.log. It takes precedence over the default path.
+func (hook *LfsHook) SetLevelDir(dir string) {
+	hook.lock.Lock()
+	defer hook.lock.Unlock()
+	hook.levelDir = dir
 }
 
 // SetDefaultPath sets default path for levels that don't have any defined output path.
@@ -120,6 +699,100 @@ func (hook *LfsHook) SetDefaultPath(defaultPath string) {
 	hook.hasDefaultPath = true
 }
 
+// lfsLimits are the limits of a level set by SetLevelLimits.
+type lfsLimits struct {
+	size    int64
+	backups int
+}
+
+// SetMaxSize sets FdMaxSize while logging, it takes effect on the next write.
+func (hook *LfsHook) SetMaxSize(size int64) {
+	hook.slk.Lock()
+	defer hook.slk.Unlock()
+	hook.FdMaxSize = size
+	atomic.AddUint32(&hook.lgen, 1)
+}
+
+// SetMaxBackups sets FdMaxLen while logging, the extra backups are removed on the next rotation.
+func (hook *LfsHook) SetMaxBackups(count int) {
+	hook.slk.Lock()
+	defer hook.slk.Unlock()
+	hook.FdMaxLen = count
+	atomic.AddUint32(&hook.lgen, 1)
+}
+
+// SetLevelLimits overrides FdMaxSize and FdMaxLen for the file of the level, e.g. to keep more backups
+// of the errors than of the debug entries, it takes precedence over SizeMap and LenMap.
+// A zero or negative value uses the hook's limit.
+// A file shared by several levels uses the limits of the level first writing to it.
+// The limits apply to the built-in rotator, the rotator returned by DefaultRotator uses the hook's limits.
+func (hook *LfsHook) SetLevelLimits(level logrus.Level, maxSize int64, maxBackups int) {
+	hook.slk.Lock()
+	defer hook.slk.Unlock()
+	if hook.limits == nil {
+		hook.limits = make(map[logrus.Level]lfsLimits)
+	}
+	hook.limits[level] = lfsLimits{size: maxSize, backups: maxBackups}
+	atomic.AddUint32(&hook.lgen, 1)
+}
+func (hook *LfsHook) maxSize() int64 {
+	hook.slk.RLock()
+	defer hook.slk.RUnlock()
+	return hook.FdMaxSize
+}
+func (hook *LfsHook) maxBackups() int {
+	hook.slk.RLock()
+	defer hook.slk.RUnlock()
+	return hook.FdMaxLen
+}
+
+// levelLimits returns the limits of the level by SetLevelLimits, SizeMap and LenMap, or FdMaxSize and FdMaxLen,
+// with the generation of the limits.
+func (hook *LfsHook) levelLimits(level logrus.Level) (lfsLimits, uint32) {
+	hook.slk.RLock()
+	defer hook.slk.RUnlock()
+	l := lfsLimits{size: hook.FdMaxSize, backups: hook.FdMaxLen}
+	if size, ok := hook.SizeMap[level]; ok && size > 0 {
+		l.size = size
+	}
+	if backups, ok := hook.LenMap[level]; ok && backups > 0 {
+		l.backups = backups
+	}
+	if set, ok := hook.limits[level]; ok {
+		if set.size > 0 {
+			l.size = set.size
+		}
+		if set.backups > 0 {
+			l.backups = set.backups
+		}
+	}
+	return l, atomic.LoadUint32(&hook.lgen)
+}
+
+// fileLimits returns the limits of the file resolved by its level, the caller must hold fe.lk.
+// They are kept on the file and resolved again only after they're changed at runtime.
+func (hook *LfsHook) fileLimits(fe *lfsFile) lfsLimits {
+	if !fe.limited || fe.lgen != atomic.LoadUint32(&hook.lgen) {
+		fe.limits, fe.lgen = hook.levelLimits(fe.level)
+		fe.limited = true
+	}
+	return fe.limits
+}
+
+// overSize reports whether writing size bytes to a file of ln bytes exceeds the max size, if it's enabled.
+func overSize(ln, size, max int64) bool {
+	return max > 0 && ln+size > max
+}
+
+// SetCombinedPath sets the path of a file receiving the entries of all levels in addition to their own files.
+// The combined file is rotated like the others, the entries are written in the formats of their levels.
+// It's written for the writer outputs too, e.g. a WriterMap with a combined file on the disk.
+func (hook *LfsHook) SetCombinedPath(path string) {
+	hook.lock.Lock()
+	defer hook.lock.Unlock()
+	hook.combinedPath = path
+}
+
 // SetDefaultWriter sets default writer for levels that don't have any defined writer.
 func (hook *LfsHook) SetDefaultWriter(defaultWriter io.Writer) {
 	hook.lock.Lock()
@@ -130,145 +803,1220 @@ func (hook *LfsHook) SetDefaultWriter(defaultWriter io.Writer) {
 
 // Fire writes the log file to defined path or using the defined writer.
 // User who run this function needs write permissions to the file or directory if the file does not yet exist.
+// It returns the context's error without writing if the hook's context is canceled, see SetContext,
+// and nil without writing if the hook is paused, see Pause.
 func (hook *LfsHook) Fire(entry *logrus.Entry) error {
+	return hook.fireContext(nil, entry)
+}
+
+// fireContext is Fire giving up the queueing when the ctx is done, a nil ctx never gives up.
+func (hook *LfsHook) fireContext(ctx context.Context, entry *logrus.Entry) error {
+	if hook.sampledOut(entry.Level) {
+		return nil
+	}
+	return hook.fireSampled(ctx, entry)
+}
+
+// fireSampled is fireContext after the 1 of n sampling of SetSampling, Resume writes the kept entries by it.
+func (hook *LfsHook) fireSampled(ctx context.Context, entry *logrus.Entry) error {
+	if hook.pauseKeep(entry) {
+		return nil
+	}
 	hook.lock.Lock()
-	defer hook.lock.Unlock()
-	if hook.writers != nil || hook.hasDefaultWriter {
-		return hook.ioWrite(entry)
-	} else if hook.paths != nil || hook.hasDefaultPath {
-		return hook.fileWrite(entry)
+	if err := hook.ctxErr(); err != nil {
+		hook.lock.Unlock()
+		return err
 	}
+	if hook.hasLevels && !hook.hasLevel(entry.Level) {
+		hook.lock.Unlock()
+		return nil
+	}
+	sampler := hook.sampler
+	hook.lock.Unlock()
 
-	return nil
+	if sampler != nil {
+		now := hook.now()
+		ok, suppressed := sampler.allow(entry.Level, now)
+		if suppressed > 0 {
+			hook.fire(ctx, sampleSummary(entry, suppressed, now))
+		}
+		if !ok {
+			return nil
+		}
+	}
+	return hook.fire(ctx, entry)
 }
 
-// Write a log line to an io.Writer.
-func (hook *LfsHook) ioWrite(entry *logrus.Entry) error {
+// fire writes the entry allowed by Fire.
+func (hook *LfsHook) fire(ctx context.Context, entry *logrus.Entry) error {
+	hook.lock.Lock()
+	entry = withDefaultFields(entry, hook.fields)
+	sl, formatter := hook.syslog, hook.levelFormatter(entry.Level)
+	if !hook.hasOutput(entry) {
+		hook.lock.Unlock()
+		hook.warnUnmatched(entry.Level, entry)
+		return nil
+	}
 	var (
-		writer io.Writer
-		msg    []byte
-		err    error
-		ok     bool
+		errs    multiError
+		pending []lfsError
 	)
-
-	if writer, ok = hook.writers[entry.Level]; !ok {
-		if hook.hasDefaultWriter {
-			writer = hook.defaultWriter
-		} else {
-			return nil
+	if hook.writers != nil || hook.hasDefaultWriter {
+		// the writers may not be safe for concurrent use, so they are written under the lock
+		var err error
+		if pending, err = hook.ioWrite(entry); err != nil {
+			errs = append(errs, err)
+		}
+		if !hook.hasFiles() {
+			hook.lock.Unlock()
+			hook.handleErrors(pending)
+			return hook.syslogWrite(sl, formatter, entry, errs.err())
 		}
 	}
+	onRotate := hook.OnRotate
+	hook.lock.Unlock()
+	hook.handleErrors(pending)
 
-	// use our formatter instead of entry.String()
-	msg, err = hook.formatter.Format(entry)
-
+	rts, err := hook.fileWrite(ctx, entry)
 	if err != nil {
-		log.Println("failed to generate string for entry:", err)
-		return err
+		errs = append(errs, err)
 	}
-	_, err = writer.Write(msg)
-	return err
+	if onRotate != nil {
+		for _, rt := range rts {
+			onRotate(entry.Level, rt.path, rt.name, rt.size)
+		}
+	}
+	return hook.syslogWrite(sl, formatter, entry, errs.err())
 }
 
-func (c *LfsHook) fileBakLen(path string) int {
-	ln := 0
-	for i := 1; i <= c.FdMaxLen; i++ {
-		_, err := os.Stat(fmt.Sprintf("%s.%d", path, i))
-		if !os.IsNotExist(err) {
-			ln++
-		} else {
-			break
+// writerFor returns the writer of the level, the caller must hold hook.lock.
+func (hook *LfsHook) writerFor(level logrus.Level) (io.Writer, bool) {
+	writer, ok := hook.writers[level]
+	if !ok && hook.threshold {
+		for l := level + 1; l <= logrus.TraceLevel && !ok; l++ {
+			writer, ok = hook.writers[l]
 		}
 	}
-	return ln
+	if !ok && hook.hasDefaultWriter {
+		return hook.defaultWriter, true
+	}
+	return writer, ok
 }
-func (c *LfsHook) fileBakMove(path string) {
-	os.RemoveAll(fmt.Sprintf("%s.%d", path, 1))
 
-	for i := 1; i < c.FdMaxLen; i++ {
-		os.Rename(fmt.Sprintf("%s.%d", path, i+1), fmt.Sprintf("%s.%d", path, i))
+// hasOutput reports whether the entry is written anywhere, the caller must hold hook.lock.
+func (hook *LfsHook) hasOutput(entry *logrus.Entry) bool {
+	if _, ok := hook.writerFor(entry.Level); ok {
+		return true
+	}
+	if _, ok := hook.filePath(entry.Level); ok {
+		return true
+	}
+	if hook.combinedPath != "" || hook.syslog != nil {
+		return true
 	}
+	_, routed := hook.routePath(entry)
+	return routed
 }
-func (c *LfsHook) fileCheck(fe *lfsFile) error {
-	fe.lk.Lock()
-	defer fe.lk.Unlock()
-	for {
-		if fe.fd == nil {
-			fe.ln = 0
-			stat, err := os.Stat(fe.path)
-			if err == nil {
-				fe.ln = stat.Size()
-			}
-			fl, err := os.OpenFile(fe.path, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0664)
-			if err != nil {
-				return err
-			}
-			fe.fd = fl
-		} else if fe.ln > c.FdMaxSize {
-			fe.fd.Close()
-			fe.fd = nil
-			ln := c.fileBakLen(fe.path)
-			if ln >= c.FdMaxLen {
-				c.fileBakMove(fe.path)
-				os.Rename(fe.path, fmt.Sprintf("%s.%d", fe.path, ln))
-			} else {
-				os.Rename(fe.path, fmt.Sprintf("%s.%d", fe.path, ln+1))
-			}
-		} else {
-			break
-		}
+
+// warnUnmatched reports once per level that the entries of the level have no output and are dropped,
+// so a level added to the logger but not to the hook is noticed. Fire only sees the levels returned by Levels,
+// so the unmapped levels of a PathMap or WriterMap are reported by Validate. The entry is nil from Validate.
+func (hook *LfsHook) warnUnmatched(level logrus.Level, entry *logrus.Entry) {
+	if level > logrus.TraceLevel {
+		return
 	}
+	hook.warned[level].Do(func() {
+		hook.handleError(fmt.Errorf("no output for level %s, its entries are dropped", level), entry, "lfshook:")
+	})
+}
 
-	return nil
+// hasFiles reports whether any file is configured besides the writers, the caller must hold hook.lock.
+func (hook *LfsHook) hasFiles() bool {
+	return hook.paths != nil || hook.levelDir != "" || hook.hasDefaultPath || hook.combinedPath != "" || hook.routeFunc != nil
 }
 
-// Write a log line directly to a file.
-func (hook *LfsHook) fileWrite(entry *logrus.Entry) error {
+// Write a log line to an io.Writer, the caller must hold hook.lock.
+// The errors for OnError are returned to be reported once hook.lock is released.
+func (hook *LfsHook) ioWrite(entry *logrus.Entry) ([]lfsError, error) {
 	var (
-		msg []byte
-		err error
+		msg  []byte
+		err  error
+		errs []lfsError
 	)
 
-	hook.flk.Lock()
-	fe, ok := hook.fls[entry.Level]
-	hook.flk.Unlock()
+	writer, ok := hook.writerFor(entry.Level)
 	if !ok {
-		var path string
-		if path, ok = hook.paths[entry.Level]; !ok {
-			if hook.hasDefaultPath {
-				path = hook.defaultPath
-			} else {
-				return nil
-			}
+		return nil, nil
+	}
+
+	// use our formatter instead of entry.String()
+	buf := getBuffer()
+	defer putBuffer(buf)
+	msg, err = formatEntry(hook.levelFormatter(entry.Level), entry, buf)
+	msg = hook.finishMsg(msg)
+
+	if err != nil {
+		errs = append(errs, lfsError{err: err, entry: entry, msg: "failed to generate string for entry:"})
+		return errs, err
+	}
+	st, err := hook.writerRotate(writer, int64(len(msg)))
+	if err != nil {
+		errs = append(errs, lfsError{err: err, entry: entry, msg: "failed to rotate writer:"})
+	}
+	n, err := hook.writeRetry(writer, msg, hook.WriteRetries)
+	st.written(msg[:n])
+	hook.stats.written(entry.Level, n, err)
+	if err != nil {
+		errs = append(errs, lfsError{err: err, entry: entry})
+	}
+	return errs, err
+}
+
+// fileBaks returns the numbers of the numbered backups of the path in ascending order, gaps included.
+// The names of the index 1 and a large index are compared to find the number's position in the names.
+func (c *LfsHook) fileBaks(path string) []int {
+	n1, n2 := c.fileBakName(path, 1), c.fileBakName(path, 999999999)
+	prefix, suffix := nameAffix(n1, n2)
+	dir := filepath.Dir(n1)
+	fls, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	seen := make(map[int]bool)
+	var baks []int
+	for _, fl := range fls {
+		name := strings.TrimSuffix(filepath.Join(dir, fl.Name()), compressSuffix)
+		if fl.IsDir() || len(name) < len(prefix)+len(suffix) || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+			continue
 		}
-		os.MkdirAll(filepath.Dir(path), 0755)
-		fe = &lfsFile{
-			path: path,
-			ln:   0,
+		n, err := strconv.Atoi(name[len(prefix) : len(name)-len(suffix)])
+		if err != nil || n <= 0 || seen[n] || c.fileBakName(path, n) != name {
+			continue
 		}
-		hook.flk.Lock()
-		hook.fls[entry.Level] = fe
-		hook.flk.Unlock()
+		seen[n] = true
+		baks = append(baks, n)
 	}
+	sort.Ints(baks)
+	return baks
+}
 
-	err = hook.fileCheck(fe)
+// DefaultBackupIndexName names the numbered backups, e.g. info.log.1, it's used if LfsHook.BackupIndexName is nil.
+func DefaultBackupIndexName(path string, index int) string {
+	return fmt.Sprintf("%s.%d", path, index)
+}
+func (c *LfsHook) fileBakName(path string, n int) string {
+	if c.BackupIndexName != nil {
+		return c.BackupIndexName(path, n)
+	}
+	return DefaultBackupIndexName(path, n)
+}
+func (c *LfsHook) fileBakRemove(path string, n int) {
+	os.Remove(c.fileBakName(path, n))
+	os.Remove(c.fileBakName(path, n) + compressSuffix)
+}
+func (c *LfsHook) fileBakRename(path string, from, to int) {
+	os.Rename(c.fileBakName(path, from), c.fileBakName(path, to))
+	os.Rename(c.fileBakName(path, from)+compressSuffix, c.fileBakName(path, to)+compressSuffix)
+}
+func (c *LfsHook) fileBakStat(path string, n int) (os.FileInfo, error) {
+	stat, err := os.Stat(c.fileBakName(path, n))
 	if err != nil {
-		return err
+		stat, err = os.Stat(c.fileBakName(path, n) + compressSuffix)
 	}
+	return stat, err
+}
+func (c *LfsHook) fileBakStale(path string, n int) bool {
+	stat, err := c.fileBakStat(path, n)
+	return err == nil && c.since(stat.ModTime()) > c.MaxAge
+}
 
-	// use our formatter instead of entry.String()
-	msg, err = hook.formatter.Format(entry)
+// fileBakTotal returns the size of the file at path plus the sizes of the backups.
+func fileBakTotal(path string, sizes []int64) int64 {
+	var total int64
+	if stat, err := os.Stat(path); err == nil {
+		total = stat.Size()
+	}
+	for _, size := range sizes {
+		total += size
+	}
+	return total
+}
 
-	if err != nil {
-		log.Println("failed to generate string for entry:", err)
-		return err
+// fileBakShift removes the stale and the oldest backups to keep room for a new one,
+// renumbers the rest contiguously from 1 and returns the name of the new backup.
+func (c *LfsHook) fileBakShift(path string, backups int) string {
+	baks := c.fileBaks(path)
+	if c.MaxAge > 0 {
+		kept := baks[:0]
+		for _, n := range baks {
+			if c.fileBakStale(path, n) {
+				c.fileBakRemove(path, n)
+			} else {
+				kept = append(kept, n)
+			}
+		}
+		baks = kept
 	}
-	n, _ := fe.fd.Write(msg)
-	fe.ln += int64(n)
-	return nil
+	for len(baks) > 0 && len(baks) >= backups {
+		c.fileBakRemove(path, baks[0])
+		baks = baks[1:]
+	}
+	if c.MaxTotalSize > 0 {
+		sizes := make([]int64, len(baks))
+		for i, n := range baks {
+			if stat, err := c.fileBakStat(path, n); err == nil {
+				sizes[i] = stat.Size()
+			}
+		}
+		for len(baks) > 0 && fileBakTotal(path, sizes) > c.MaxTotalSize {
+			c.fileBakRemove(path, baks[0])
+			baks, sizes = baks[1:], sizes[1:]
+		}
+	}
+	for i, n := range baks {
+		if n != i+1 {
+			c.fileBakRename(path, n, i+1)
+		}
+	}
+	return c.fileBakName(path, len(baks)+1)
 }
 
-// Levels returns configured log levels.
-func (hook *LfsHook) Levels() []logrus.Level {
-	return logrus.AllLevels
+// isDayBackup reports whether the name is a daily backup of the base, e.g. info.log-2024-01-02.1.gz.
+func isDayBackup(base, name string) bool {
+	if !strings.HasPrefix(name, base+"-") {
+		return false
+	}
+	name = strings.TrimSuffix(strings.TrimPrefix(name, base+"-"), compressSuffix)
+	if len(name) < 10 {
+		return false
+	}
+	if _, err := time.Parse("2006-01-02", name[:10]); err != nil {
+		return false
+	}
+	if name = name[10:]; name == "" {
+		return true
+	}
+	_, err := strconv.Atoi(strings.TrimPrefix(name, "."))
+	return strings.HasPrefix(name, ".") && err == nil
+}
+func (c *LfsHook) fileDayClean(path string) {
+	fls, err := ioutil.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return
+	}
+	base := filepath.Base(path)
+	for _, fl := range fls {
+		if fl.IsDir() || !isDayBackup(base, fl.Name()) {
+			continue
+		}
+		if c.since(fl.ModTime()) > c.MaxAge {
+			os.Remove(filepath.Join(filepath.Dir(path), fl.Name()))
+		}
+	}
+}
+
+// fileAgeClean removes the backups of the path older than MaxAge, the caller must hold zlk.
+func (c *LfsHook) fileAgeClean(path string) {
+	c.fileDayClean(path)
+	if c.BackupNameFunc != nil {
+		for _, bak := range c.fileBakMatches(path) {
+			if c.since(bak.ModTime()) > c.MaxAge {
+				os.Remove(bak.path)
+			}
+		}
+		return
+	}
+	for _, n := range c.fileBaks(path) {
+		if c.fileBakStale(path, n) {
+			c.fileBakRemove(path, n)
+		}
+	}
+}
+func (c *LfsHook) fileDayMove(fe *lfsFile) {
+	c.zlk.Lock()
+	if c.MaxAge > 0 {
+		c.fileDayClean(fe.path)
+	}
+	name := fmt.Sprintf("%s-%s", fe.path, fe.day.Format("2006-01-02"))
+	for i := 1; fileExists(name); i++ {
+		name = fmt.Sprintf("%s-%s.%d", fe.path, fe.day.Format("2006-01-02"), i)
+	}
+	if err := c.fileMove(fe.path, name); err != nil {
+		c.zlk.Unlock()
+		return
+	}
+	fe.rts = append(fe.rts, lfsRotation{path: fe.path, name: name, size: fe.ln})
+	atomic.AddUint64(&c.stats.rotations, 1)
+	c.fileManifest(fe, name, rotateDaily)
+	c.fileCompress(name)
+	c.fileUpload(fe, name)
+}
+func expandPath(tmpl string, t time.Time) string {
+	if !strings.Contains(tmpl, "%") {
+		return tmpl
+	}
+	return strings.NewReplacer(
+		"%Y", t.Format("2006"),
+		"%m", t.Format("01"),
+		"%d", t.Format("02"),
+		"%H", t.Format("15"),
+		"%M", t.Format("04"),
+	).Replace(tmpl)
+}
+func dayOf(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+func (c *LfsHook) fileRotate(fe *lfsFile, reason string) error {
+	if c.RotateMode == RotateCopyTruncate {
+		// the file is truncated in place, keep it open
+		fe.closeGzip()
+		fe.flush()
+	} else {
+		fe.close()
+	}
+	name, err := c.fileRotator(fe).Rotate(fe.path)
+	if err != nil {
+		return err
+	}
+	fe.rts = append(fe.rts, lfsRotation{path: fe.path, name: name, size: fe.ln})
+	fe.rotatedAt = c.now()
+	atomic.AddUint64(&c.stats.rotations, 1)
+	c.fileManifest(fe, name, reason)
+	c.fileUpload(fe, name)
+	if fe.fd != nil {
+		if c.fileChanged(fe) {
+			// moved by a custom rotator
+			fe.close()
+		} else {
+			fe.ln = 0
+			c.fileGzip(fe)
+			return c.fileStart(fe, fe.rotatedAt)
+		}
+	}
+	return nil
+}
+func (c *LfsHook) shouldRotate(fe *lfsFile, size int64) bool {
+	return c.fileRotator(fe).ShouldRotate(RotateState{
+		Path:       fe.path,
+		Size:       fe.ln,
+		HeaderSize: fe.hd,
+		Lines:      fe.lines,
+		OpenedAt:   fe.openedAt,
+	}, size)
+}
+
+// fileLink points the symlink to the active file, a temporary link is renamed so readers never see a broken link.
+func (c *LfsHook) fileLink(fe *lfsFile) {
+	link := linkPath(fe.tmpl, c.Symlink)
+	if link == fe.path {
+		return
+	}
+	target, err := filepath.Rel(filepath.Dir(link), fe.path)
+	if err != nil {
+		target, _ = filepath.Abs(fe.path)
+	}
+	tmp := link + ".tmp"
+	os.Remove(tmp)
+	if err := os.Symlink(target, tmp); err != nil {
+		return
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		os.Remove(tmp)
+	}
+}
+
+// placeholderRe matches the time placeholders of expandPath with their leading separator.
+var placeholderRe = regexp.MustCompile(`[-_.]?%[YmdHM]`)
+
+// linkPath returns the fixed path of the Symlink of the path template, without the time placeholders.
+func linkPath(tmpl, ext string) string {
+	path := filepath.Clean(placeholderRe.ReplaceAllString(tmpl, ""))
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ext
+}
+
+// rotateReason returns the reason of the rotation decided by the rotator.
+func (c *LfsHook) rotateReason(fe *lfsFile, size int64) string {
+	if c.Rotator != nil {
+		return rotateCustom
+	}
+	if overSize(fe.ln, size, c.fileLimits(fe).size) {
+		return rotateSize
+	}
+	if c.MaxLines > 0 && fe.lines >= c.MaxLines {
+		return rotateLines
+	}
+	return rotateTime
+}
+
+// fileStart resets the state of the file opened or truncated, and writes the header to the empty file.
+func (c *LfsHook) fileStart(fe *lfsFile, now time.Time) error {
+	fe.openedAt = now
+	fe.firstAt = time.Time{}
+	fe.lastAt = time.Time{}
+	fe.hd = 0
+	fe.lines = 0
+	if fe.ln <= 0 && c.FileHeader != nil {
+		n, err := fe.writer().Write(frameMsg(c.FileHeader(), c.Framing))
+		if fe.gz == nil {
+			fe.ln += int64(n)
+		} else if err == nil {
+			err = fe.gz.Flush()
+		}
+		fe.hd = fe.ln
+		if err != nil {
+			fe.close()
+			return err
+		}
+	}
+	return nil
+}
+
+// openFlags returns the flags to open the log files, O_CREATE and O_APPEND are always set.
+func (c *LfsHook) openFlags() int {
+	flags := c.OpenFlags &^ (os.O_TRUNC | os.O_EXCL)
+	if flags&(os.O_WRONLY|os.O_RDWR) == 0 {
+		flags |= os.O_RDWR
+	}
+	return flags | os.O_CREATE | os.O_APPEND
+}
+
+// reopenInterval returns the min interval to check the path for ReopenOnChange.
+func (c *LfsHook) reopenInterval() time.Duration {
+	if c.ReopenCheckInterval > 0 {
+		return c.ReopenCheckInterval
+	}
+	return reopenCheckInterval
+}
+
+// fileChanged reports whether the path no longer refers to the opened file, e.g. moved by logrotate.
+func (c *LfsHook) fileChanged(fe *lfsFile) bool {
+	fst, err := fe.fd.Stat()
+	if err != nil {
+		return true
+	}
+	pst, err := os.Stat(fe.path)
+	if err != nil {
+		return true
+	}
+	return !os.SameFile(fst, pst)
+}
+
+// fileCheck opens or rotates the file before writing size bytes, the caller must hold fe.lk.
+// The file is rotated if the write would exceed FdMaxSize, an entry larger than FdMaxSize
+// is still written to its own file, after the header if any.
+func (c *LfsHook) fileCheck(fe *lfsFile, size int64) error {
+	now := c.now()
+	if path := expandPath(fe.tmpl, now); path != fe.path {
+		fe.close()
+		if err := os.MkdirAll(filepath.Dir(path), c.DirMode); err != nil {
+			// the path isn't recorded, so the next write retries
+			return fmt.Errorf("failed to create the directory of %s: %v", path, err)
+		}
+		fe.path = path
+	}
+	if c.ReopenOnChange && fe.fd != nil && now.Sub(fe.checkedAt) >= c.reopenInterval() {
+		fe.checkedAt = now
+		if c.fileChanged(fe) {
+			fe.close()
+		}
+	}
+	if c.SizeCheckWrites > 0 && fe.fd != nil {
+		if fe.writes++; fe.writes >= c.SizeCheckWrites {
+			fe.writes = 0
+			fe.flush()
+			if stat, err := fe.fd.Stat(); err == nil {
+				fe.ln = stat.Size()
+			}
+		}
+	}
+	// rotate once at most, the file may not be moved away
+	rotated := false
+	for {
+		if fe.fd == nil {
+			fe.ln = 0
+			fe.day = dayOf(now)
+			flags := c.openFlags()
+			truncate := false
+			if c.Truncate {
+				_, opened := c.truncated.LoadOrStore(fe.path, true)
+				truncate = !opened
+			}
+			if truncate {
+				flags |= os.O_TRUNC
+			} else if stat, err := os.Stat(fe.path); err == nil {
+				fe.ln = stat.Size()
+				fe.day = dayOf(stat.ModTime())
+			}
+			fl, err := os.OpenFile(fe.path, flags, c.FileMode)
+			if err != nil {
+				if truncate {
+					c.truncated.Delete(fe.path)
+				}
+				return err
+			}
+			fe.fd = fl
+			if c.BufferSize > 0 {
+				fe.bw = bufio.NewWriterSize(fl, c.BufferSize)
+			}
+			c.fileGzip(fe)
+			if err := c.fileStart(fe, now); err != nil {
+				return err
+			}
+			if c.Symlink != "" {
+				c.fileLink(fe)
+			}
+		} else if rotated {
+			break
+		} else if c.RotateDaily && fe.day.Before(dayOf(now)) {
+			if fe.ln <= fe.hd {
+				fe.day = dayOf(now)
+				continue
+			}
+			fe.close()
+			c.fileDayMove(fe)
+			rotated = true
+		} else if c.RotationInterval > 0 && fe.ln <= fe.hd && now.Sub(fe.openedAt) >= c.RotationInterval {
+			// don't count the interval of an empty file
+			fe.openedAt = now
+		} else if c.MinRotateInterval > 0 && !fe.rotatedAt.IsZero() && c.since(fe.rotatedAt) < c.MinRotateInterval {
+			// rotated recently, keep writing the current file
+			break
+		} else if c.shouldRotate(fe, size) {
+			if err := c.fileRotate(fe, c.rotateReason(fe, size)); err != nil {
+				c.fileError(fe, err, "failed to rotate log file:")
+			}
+			rotated = true
+		} else {
+			break
+		}
+	}
+
+	return nil
+}
+
+// PathFor returns the path of the file the entries of the level are written to now, with the time placeholders
+// expanded, without writing anything. It returns false if the level isn't written to a file.
+// The entries routed by SetFieldRoute aren't considered.
+func (hook *LfsHook) PathFor(level logrus.Level) (string, bool) {
+	hook.lock.Lock()
+	defer hook.lock.Unlock()
+	path, ok := hook.filePath(level)
+	if !ok {
+		return "", false
+	}
+	return expandPath(path, hook.now()), true
+}
+
+// filePath returns the configured path of the level, the caller must hold hook.lock.
+func (hook *LfsHook) filePath(level logrus.Level) (string, bool) {
+	if path, ok := hook.paths[level]; ok {
+		return path, true
+	}
+	if hook.threshold {
+		for l := level + 1; l <= logrus.TraceLevel; l++ {
+			if path, ok := hook.paths[l]; ok {
+				return path, true
+			}
+		}
+	}
+	if hook.levelDir != "" {
+		return filepath.Join(hook.levelDir, level.String()+".log"), true
+	}
+	if hook.hasDefaultPath {
+		return hook.defaultPath, true
+	}
+	return "", false
+}
+
+// fileGet returns the file of the path, it's created for the level if not opened yet.
+// The levels of the same path share the file, so the size and the rotation are counted once.
+// The lookup and the creation are done under flk at once, so exactly one file is created for a path.
+func (hook *LfsHook) fileGet(level logrus.Level, path string) *lfsFile {
+	hook.flk.Lock()
+	defer hook.flk.Unlock()
+	fe, ok := hook.fls[path]
+	if !ok {
+		fe = &lfsFile{
+			tmpl:  path,
+			ln:    0,
+			level: level,
+		}
+		fe.limits, fe.lgen = hook.levelLimits(level)
+		fe.limited = true
+		hook.fls[path] = fe
+	}
+	return fe
+}
+
+// fileFor returns the file of the level or the routed file of the path.
+func (hook *LfsHook) fileFor(level logrus.Level, path string, routed bool) *lfsFile {
+	if routed {
+		return hook.routeGet(level, path)
+	}
+	return hook.fileGet(level, path)
+}
+
+// openedFiles returns all the files of the levels and the routes, the caller must hold hook.flk.
+func (hook *LfsHook) openedFiles() []*lfsFile {
+	fls := make([]*lfsFile, 0, len(hook.fls)+len(hook.routes))
+	for _, fe := range hook.fls {
+		fls = append(fls, fe)
+	}
+	for _, fe := range hook.routes {
+		fls = append(fls, fe)
+	}
+	return fls
+}
+
+// Write a log line directly to a file.
+// Only the configuration is read under hook.lock, the file is rotated and written under its own lock,
+// so the writes to different files don't block each other.
+func (hook *LfsHook) fileWrite(ctx context.Context, entry *logrus.Entry) ([]lfsRotation, error) {
+	var (
+		msg []byte
+		err error
+	)
+
+	hook.lock.Lock()
+	path, routed := hook.routePath(entry)
+	ok := routed
+	if !routed {
+		path, ok = hook.filePath(entry.Level)
+	}
+	combined := hook.combinedPath
+	if combined == path {
+		combined = ""
+	}
+	formatter := hook.levelFormatter(entry.Level)
+	if ok || combined != "" {
+		hook.startTicks()
+	}
+	hook.lock.Unlock()
+	if !ok && combined == "" {
+		return nil, nil
+	}
+
+	// use our formatter instead of entry.String(), the queued msg can't use a pooled buffer
+	var buf *bytes.Buffer
+	if hook.QueueSize <= 0 {
+		buf = getBuffer()
+		defer putBuffer(buf)
+	}
+	msg, err = formatEntry(formatter, entry, buf)
+	msg = hook.finishMsg(msg)
+
+	if err != nil {
+		hook.handleError(err, entry, "failed to generate string for entry:")
+		return nil, err
+	}
+	var dup *lfsDup
+	if hook.DedupeConsecutive {
+		dup = newDup(entry, formatter)
+	}
+	if hook.QueueSize > 0 {
+		var errs multiError
+		if ok {
+			if err := hook.enqueue(ctx, lfsEntry{entry: entry, level: entry.Level, path: path, routed: routed, msg: msg, dup: dup}); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if combined != "" {
+			if err := hook.enqueue(ctx, lfsEntry{entry: entry, level: entry.Level, path: combined, msg: msg, dup: dup}); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return nil, errs.err()
+	}
+	var rts []lfsRotation
+	if ok {
+		rts, err = hook.fileWriteMsg(hook.fileFor(entry.Level, path, routed), entry.Level, msg, dup)
+		if err != nil {
+			hook.handleError(err, entry, "")
+			hook.fallbackWrite(msg)
+		}
+	}
+	if combined != "" {
+		crts, cerr := hook.fileWriteMsg(hook.fileGet(entry.Level, combined), entry.Level, msg, dup)
+		rts = append(rts, crts...)
+		if cerr != nil {
+			hook.handleError(cerr, entry, "")
+			if err == nil {
+				err = cerr
+			}
+		}
+	}
+	return rts, err
+}
+
+// maxAgeCheckInterval is the longest interval between the background checks of MaxAge.
+const maxAgeCheckInterval = time.Hour
+
+// startTicks starts the background flushes, syncs, MaxAge and ReopenOnChange checks if not started yet, the caller must hold hook.lock.
+func (hook *LfsHook) startTicks() {
+	if hook.fstop == nil && (hook.BufferSize > 0 || hook.CompressActive) && hook.FlushInterval > 0 {
+		hook.fstop = make(chan struct{})
+		go hook.tickLoop(hook.fstop, hook.FlushInterval, hook.Flush, "failed to flush log file:")
+	}
+	if hook.sstop == nil && hook.SyncInterval > 0 {
+		hook.sstop = make(chan struct{})
+		go hook.tickLoop(hook.sstop, hook.SyncInterval, hook.Sync, "failed to sync log file:")
+	}
+	if hook.astop == nil && hook.MaxAge > 0 && hook.Rotator == nil {
+		interval := maxAgeCheckInterval
+		if hook.MaxAge < interval {
+			interval = hook.MaxAge
+		}
+		hook.astop = make(chan struct{})
+		go hook.tickLoop(hook.astop, interval, hook.cleanExpired, "failed to remove expired log file:")
+	}
+	if hook.rstop == nil && hook.ReopenOnChange {
+		hook.rstop = make(chan struct{})
+		go hook.tickLoop(hook.rstop, hook.reopenInterval(), hook.reopenChanged, "failed to reopen log file:")
+	}
+}
+
+// fallbackWrite writes the entry failed to be written to its file to FallbackWriter if any.
+func (hook *LfsHook) fallbackWrite(msg []byte) {
+	if hook.FallbackWriter == nil {
+		return
+	}
+	hook.wlk.Lock()
+	defer hook.wlk.Unlock()
+	hook.FallbackWriter.Write(msg)
+}
+
+// fileWriteMsg writes the formatted entry to the file, rotating it if needed.
+// The dup is the entry compared for DedupeConsecutive, nil if it's disabled.
+// fe.lk is held from the check to the write, so a rotation by another goroutine, Rotate or Reopen
+// happens entirely before or after the write, and the entry lands in exactly one file.
+func (hook *LfsHook) fileWriteMsg(fe *lfsFile, level logrus.Level, msg []byte, dup *lfsDup) ([]lfsRotation, error) {
+	fe.lk.Lock()
+	if fe.closed {
+		// the file was closed by Close, use the new one
+		fe.lk.Unlock()
+		return hook.fileWriteMsg(hook.fileFor(level, fe.tmpl, fe.routed), level, msg, dup)
+	}
+	defer func() {
+		errs := fe.errs
+		fe.errs = nil
+		fe.lk.Unlock()
+		hook.handleErrors(errs)
+	}()
+	if dup != nil && fe.dup != nil && fe.dup.key == dup.key {
+		fe.dup.repeats++
+		return nil, nil
+	}
+	if hook.MultiProcess {
+		defer hook.fileLock(fe)()
+		hook.fileSynced(fe)
+	}
+	err := hook.fileCheck(fe, int64(len(msg)))
+	rts := fe.rts
+	fe.rts = nil
+	if err != nil {
+		hook.stats.written(level, 0, err)
+		return rts, err
+	}
+	if dup != nil {
+		hook.fileDedupe(fe, dup)
+	}
+	n, err := hook.fileAppend(fe, msg)
+	if err == nil && hook.SyncOnWrite {
+		err = fe.sync()
+	} else if err == nil && (hook.MultiProcess || level <= logrus.FatalLevel) {
+		err = fe.flush()
+	}
+	hook.stats.written(level, n, err)
+	if err != nil {
+		// reopen the file on the next Fire
+		fe.close()
+	}
+	return rts, err
+}
+
+// finishMsg applies MaxLineBytes, EnsureNewline and Framing to the formatted msg.
+func (hook *LfsHook) finishMsg(msg []byte) []byte {
+	msg = truncateMsg(msg, hook.MaxLineBytes)
+	if hook.EnsureNewline {
+		msg = ensureNewline(msg)
+	}
+	return frameMsg(msg, hook.Framing)
+}
+
+// fileAppend writes the msg to the opened file, the caller must hold fe.lk.
+func (hook *LfsHook) fileAppend(fe *lfsFile, msg []byte) (int, error) {
+	retries := hook.WriteRetries
+	if fe.bw != nil || fe.gz != nil {
+		// the buffered writers keep failing after an error
+		retries = 0
+	}
+	n, err := hook.writeRetry(fe.writer(), msg, retries)
+	if fe.gz == nil {
+		fe.ln += int64(n)
+	} else if err == nil && hook.FlushInterval <= 0 {
+		err = fe.gz.Flush()
+	}
+	fe.lines += int64(bytes.Count(msg[:n], []byte{'\n'}))
+	if n > 0 {
+		if fe.firstAt.IsZero() {
+			fe.firstAt = hook.now()
+		}
+		fe.lastAt = hook.now()
+	}
+	return n, err
+}
+
+// fileError keeps the error found under fe.lk for handleErrors, so OnError isn't called under the locks.
+func (c *LfsHook) fileError(fe *lfsFile, err error, msg string) {
+	fe.errs = append(fe.errs, lfsError{err: err, msg: msg})
+}
+
+// handleErrors passes the errors kept by fileError to handleError, the caller must not hold the hook's locks.
+func (hook *LfsHook) handleErrors(errs []lfsError) {
+	for _, e := range errs {
+		hook.handleError(e.err, e.entry, e.msg)
+	}
+}
+
+// handleError passes the error to OnError, or prints it with the msg to the standard logger if OnError is nil.
+// The error is not printed if the msg is empty, such errors are returned by Fire.
+func (hook *LfsHook) handleError(err error, entry *logrus.Entry, msg string) {
+	if onError := hook.OnError; onError != nil {
+		onError(err, entry)
+	} else if msg != "" {
+		log.Println(msg, err)
+	}
+}
+
+// tickLoop calls f every interval until stop is closed, the errors are passed to handleError with the msg.
+func (hook *LfsHook) tickLoop(stop chan struct{}, interval time.Duration, f func() error, msg string) {
+	tk := time.NewTicker(interval)
+	defer tk.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-tk.C:
+			if err := f(); err != nil {
+				hook.handleError(err, nil, msg)
+			}
+		}
+	}
+}
+
+// reopenChanged reopens the opened files whose path no longer refers to them for ReopenOnChange,
+// so the entries aren't written to a removed file after an idle period. It returns an error combining
+// the failed reopens.
+func (hook *LfsHook) reopenChanged() error {
+	var (
+		errs    multiError
+		rts     []lfsRotation
+		lvs     []logrus.Level
+		pending []lfsError
+	)
+	hook.flk.Lock()
+	fls := hook.openedFiles()
+	hook.flk.Unlock()
+
+	for _, fe := range fls {
+		fe.lk.Lock()
+		if fe.closed || fe.fd == nil {
+			fe.lk.Unlock()
+			continue
+		}
+		fe.checkedAt = hook.now()
+		if hook.fileChanged(fe) {
+			fe.close()
+			unlock := hook.fileLock(fe)
+			if err := hook.fileCheck(fe, 0); err != nil {
+				errs = append(errs, err)
+			}
+			unlock()
+		}
+		for _, rt := range fe.rts {
+			rts = append(rts, rt)
+			lvs = append(lvs, fe.level)
+		}
+		fe.rts = nil
+		pending = append(pending, fe.errs...)
+		fe.errs = nil
+		fe.lk.Unlock()
+	}
+
+	hook.lock.Lock()
+	onRotate := hook.OnRotate
+	hook.lock.Unlock()
+	if onRotate != nil {
+		for i, rt := range rts {
+			onRotate(lvs[i], rt.path, rt.name, rt.size)
+		}
+	}
+	hook.handleErrors(pending)
+	return errs.err()
+}
+
+// cleanExpired removes the backups older than MaxAge of the opened files, so they are removed
+// without waiting for a rotation. The gaps left in the numbered backups are closed by the next rotation.
+func (hook *LfsHook) cleanExpired() error {
+	hook.flk.Lock()
+	fls := hook.openedFiles()
+	hook.flk.Unlock()
+
+	paths := make(map[string]bool)
+	for _, fe := range fls {
+		fe.lk.Lock()
+		if !fe.closed && fe.path != "" {
+			paths[fe.path] = true
+		}
+		fe.lk.Unlock()
+	}
+	// wait for the pending compression before removing the backups
+	hook.zlk.Lock()
+	defer hook.zlk.Unlock()
+	for path := range paths {
+		hook.fileAgeClean(path)
+	}
+	return nil
+}
+
+// Flush writes the buffered entries to the files and returns the first error encountered.
+func (hook *LfsHook) Flush() error {
+	var err error
+	hook.flk.Lock()
+	defer hook.flk.Unlock()
+	for _, fe := range hook.openedFiles() {
+		fe.lk.Lock()
+		if e := fe.flush(); e != nil && err == nil {
+			err = e
+		}
+		fe.lk.Unlock()
+	}
+	return err
+}
+
+// Sync flushes the buffered entries and commits the files to the disk, it returns the first error encountered.
+func (hook *LfsHook) Sync() error {
+	var err error
+	hook.flk.Lock()
+	defer hook.flk.Unlock()
+	for _, fe := range hook.openedFiles() {
+		fe.lk.Lock()
+		if e := fe.sync(); e != nil && err == nil {
+			err = e
+		}
+		fe.lk.Unlock()
+	}
+	return err
+}
+
+// Rotate rotates all opened log files immediately regardless of their sizes, and opens the new files
+// with their headers, e.g. to start fresh files before a deploy. It can be called concurrently with Fire.
+// The files shared by several levels are rotated once, the empty files are skipped.
+// It returns an error combining the failed rotations.
+func (hook *LfsHook) Rotate() error {
+	var (
+		errs    multiError
+		rts     []lfsRotation
+		lvs     []logrus.Level
+		pending []lfsError
+	)
+	hook.flk.Lock()
+	fls := hook.openedFiles()
+	hook.flk.Unlock()
+
+	rotated := make(map[string]bool)
+	for _, fe := range fls {
+		fe.lk.Lock()
+		if fe.closed || fe.path == "" {
+			fe.lk.Unlock()
+			continue
+		}
+		if err := fe.flush(); err != nil {
+			errs = append(errs, err)
+		}
+		if stat, err := os.Stat(fe.path); err != nil || stat.Size() <= 0 || rotated[fe.path] {
+			// the file is rotated by another level, reopen it
+			fe.close()
+			fe.lk.Unlock()
+			continue
+		}
+		rotated[fe.path] = true
+		unlock := hook.fileLock(fe)
+		if err := hook.fileRotate(fe, rotateManual); err != nil {
+			errs = append(errs, err)
+		} else if err := hook.fileCheck(fe, 0); err != nil {
+			errs = append(errs, err)
+		}
+		unlock()
+		for _, rt := range fe.rts {
+			rts = append(rts, rt)
+			lvs = append(lvs, fe.level)
+		}
+		fe.rts = nil
+		pending = append(pending, fe.errs...)
+		fe.errs = nil
+		fe.lk.Unlock()
+	}
+
+	hook.lock.Lock()
+	onRotate := hook.OnRotate
+	hook.lock.Unlock()
+	if onRotate != nil {
+		for i, rt := range rts {
+			onRotate(lvs[i], rt.path, rt.name, rt.size)
+		}
+	}
+	hook.handleErrors(pending)
+	return errs.err()
+}
+
+// Reopen flushes and closes all opened log files, so they are reopened on the next Fire.
+// It can be used to cooperate with external tools such as logrotate, e.g. on SIGHUP.
+func (hook *LfsHook) Reopen() error {
+	var err error
+	hook.flk.Lock()
+	defer hook.flk.Unlock()
+	for _, fe := range hook.openedFiles() {
+		fe.lk.Lock()
+		if e := fe.close(); e != nil && err == nil {
+			err = e
+		}
+		fe.lk.Unlock()
+	}
+	return err
+}
+
+// Close drains the queued entries, flushes and closes all opened log files and waits for the pending compressions
+// and uploads. It returns the first error encountered.
+// It is safe to call concurrently with Fire; the files will be reopened on the next Fire,
+// so the hook remains usable after Close.
+func (hook *LfsHook) Close() error {
+	var (
+		err     error
+		pending []lfsError
+	)
+	defer func() {
+		hook.handleErrors(pending)
+	}()
+	hook.stopQueue()
+	hook.stopUpload()
+	hook.lock.Lock()
+	defer hook.lock.Unlock()
+	defer hook.zwg.Wait()
+	hook.flk.Lock()
+	defer hook.flk.Unlock()
+	for _, fe := range hook.openedFiles() {
+		fe.lk.Lock()
+		if e := hook.dedupeFlush(fe); e != nil && err == nil {
+			err = e
+		}
+		if e := fe.close(); e != nil && err == nil {
+			err = e
+		}
+		fe.release()
+		fe.closed = true
+		pending = append(pending, fe.errs...)
+		fe.errs = nil
+		fe.lk.Unlock()
+	}
+	hook.fls = make(map[string]*lfsFile)
+	hook.routes = nil
+	if hook.fstop != nil {
+		close(hook.fstop)
+		hook.fstop = nil
+	}
+	if hook.sstop != nil {
+		close(hook.sstop)
+		hook.sstop = nil
+	}
+	if hook.astop != nil {
+		close(hook.astop)
+		hook.astop = nil
+	}
+	if hook.rstop != nil {
+		close(hook.rstop)
+		hook.rstop = nil
+	}
+	if hook.CloseWriters {
+		if e := hook.closeWriters(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// closeWriters closes the writers implementing io.Closer, the shared writers are closed once.
+// It returns an error combining the failed closes.
+func (hook *LfsHook) closeWriters() error {
+	var (
+		errs   multiError
+		closed []io.Closer
+	)
+	writers := make([]io.Writer, 0, len(hook.writers)+1)
+	if hook.hasDefaultWriter {
+		writers = append(writers, hook.defaultWriter)
+	}
+	for _, writer := range hook.writers {
+		if fw, ok := writer.(fanoutWriter); ok {
+			writers = append(writers, fw...)
+		} else {
+			writers = append(writers, writer)
+		}
+	}
+	for _, writer := range writers {
+		closer, ok := writer.(io.Closer)
+		if !ok {
+			continue
+		}
+		if reflect.TypeOf(closer).Comparable() {
+			dup := false
+			for _, c := range closed {
+				if c == closer {
+					dup = true
+					break
+				}
+			}
+			if dup {
+				continue
+			}
+			closed = append(closed, closer)
+		}
+		if err := closer.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs.err()
+}
+
+// SetLevels overrides the log levels returned by Levels.
+// logrus reads the levels only once in AddHook, so Fire also skips the entries of other levels
+// in case SetLevels is called after adding the hook.
+func (hook *LfsHook) SetLevels(levels []logrus.Level) {
+	hook.lock.Lock()
+	defer hook.lock.Unlock()
+	hook.levels = levels
+	hook.hasLevels = true
+}
+
+// Levels returns configured log levels.
+// If the hook has a default path, writer or level dir, all levels are returned unless set by SetLevels.
+// With SetThreshold, the levels more severe than the configured ones are returned too.
+func (hook *LfsHook) Levels() []logrus.Level {
+	hook.lock.Lock()
+	defer hook.lock.Unlock()
+	if !hook.hasLevels && (hook.hasDefaultPath || hook.hasDefaultWriter || hook.levelDir != "" || hook.combinedPath != "" || hook.routeFunc != nil || len(hook.levels) <= 0) {
+		return logrus.AllLevels
+	}
+	if !hook.hasLevels && hook.threshold {
+		// the more severe levels of the least severe configured level
+		max := logrus.PanicLevel
+		for _, level := range hook.levels {
+			if level > max {
+				max = level
+			}
+		}
+		return append([]logrus.Level(nil), logrus.AllLevels[:max+1]...)
+	}
+	return append([]logrus.Level(nil), hook.levels...)
 }
@@ -1,9 +1,24 @@
 package loglfshook
 
 import (
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
 )
 
 func TestLog(t *testing.T) {
@@ -22,3 +37,3546 @@ func TestLog(t *testing.T) {
 		logrus.Infof("this is info")
 	}
 }
+
+func TestClose(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "info.log")
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	hook := NewLfsHook(path, nil)
+	logger.AddHook(hook)
+
+	logger.Info("before close")
+	if err := hook.Close(); err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("after close")
+	if err := hook.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	bts, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(bts), "before close") || !strings.Contains(string(bts), "after close") {
+		t.Fatalf("unexpected content: %s", bts)
+	}
+}
+
+func TestRotateDaily(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "info.log")
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	hook := NewLfsHook(path, nil)
+	hook.RotateDaily = true
+	logger.AddHook(hook)
+
+	logger.Info("yesterday")
+	hook.Close()
+	yesterday := time.Now().AddDate(0, 0, -1)
+	if err := os.Chtimes(path, yesterday, yesterday); err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("today")
+	hook.Close()
+
+	bts, err := ioutil.ReadFile(path + "-" + yesterday.Format("2006-01-02"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(bts), "yesterday") || strings.Contains(string(bts), "today") {
+		t.Fatalf("unexpected rotated content: %s", bts)
+	}
+}
+
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+func (c *fakeClock) add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+func TestRotateDailyClock(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "info.log")
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	hook := NewLfsHook(path, nil)
+	hook.RotateDaily = true
+	hook.setClock(&fakeClock{t: time.Date(2024, 1, 2, 23, 59, 0, 0, time.Local)})
+	logger.AddHook(hook)
+	defer hook.Close()
+
+	logger.Info("yesterday")
+	hook.clock.(*fakeClock).add(2 * time.Minute)
+	logger.Info("today")
+
+	bts, err := ioutil.ReadFile(path + "-2024-01-02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(bts), "yesterday") || strings.Contains(string(bts), "today") {
+		t.Fatalf("unexpected rotated content: %s", bts)
+	}
+}
+
+func TestCloseConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	hook := NewLfsHook(filepath.Join(dir, "info.log"), nil)
+	logger.AddHook(hook)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				logger.Info("concurrent")
+			}
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		if err := hook.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+	if err := hook.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRotationInterval(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "info.log")
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	hook := NewLfsHook(path, nil)
+	hook.RotationInterval = time.Hour
+	clk := &fakeClock{t: time.Now()}
+	hook.setClock(clk)
+	logger.AddHook(hook)
+	defer hook.Close()
+
+	logger.Info("first")
+	clk.add(2 * time.Hour)
+	logger.Info("second")
+
+	bts, err := ioutil.ReadFile(path + ".1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(bts), "first") || strings.Contains(string(bts), "second") {
+		t.Fatalf("unexpected rotated content: %s", bts)
+	}
+}
+
+func TestCompress(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "info.log")
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	hook := NewLfsHook(path, nil, 1024, 3)
+	hook.Compress = true
+	logger.AddHook(hook)
+
+	for i := 0; i < 200; i++ {
+		logger.Info("this is info")
+	}
+	if err := hook.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		name := fmt.Sprintf("%s.%d", path, i)
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Fatalf("%s should be compressed", name)
+		}
+		fl, err := os.Open(name + ".gz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		zr, err := gzip.NewReader(fl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bts, err := ioutil.ReadAll(zr)
+		fl.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(bts), "this is info") {
+			t.Fatalf("unexpected content: %s", bts)
+		}
+	}
+	if _, err := os.Stat(path + ".4.gz"); !os.IsNotExist(err) {
+		t.Fatal("too many backups")
+	}
+}
+
+func TestMaxAge(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "info.log")
+	old := time.Now().AddDate(0, 0, -8)
+	for i := 1; i <= 3; i++ {
+		name := fmt.Sprintf("%s.%d", path, i)
+		if err := ioutil.WriteFile(name, []byte(name), 0664); err != nil {
+			t.Fatal(err)
+		}
+		if i < 3 {
+			os.Chtimes(name, old, old)
+		}
+	}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	hook := NewLfsHook(path, nil, 10, 5)
+	hook.MaxAge = 7 * 24 * time.Hour
+	logger.AddHook(hook)
+	defer hook.Close()
+
+	logger.Info("this is info")
+	logger.Info("this is info")
+
+	bts, err := ioutil.ReadFile(path + ".1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(bts) != path+".3" {
+		t.Fatalf("unexpected backup: %s", bts)
+	}
+	if _, err := os.Stat(path + ".2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatal("stale backups should be removed")
+	}
+}
+
+func TestReopenOnChangeIdle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "info.log")
+	hook, err := NewLfsHookWithOptions(path, WithRawMode(), WithReopenOnChange(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	defer hook.Close()
+
+	logger.Info("before remove")
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	// the file is recreated in background without writing
+	deadline := time.Now().Add(2 * time.Second)
+	for _, err := os.Stat(path); err != nil; _, err = os.Stat(path) {
+		if time.Now().After(deadline) {
+			t.Fatal("the removed file should be reopened by the idle hook")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	logger.Info("after remove")
+	if bts, _ := ioutil.ReadFile(path); string(bts) != "after remove\n" {
+		t.Fatalf("unexpected content: %q", bts)
+	}
+}
+
+func TestMaxAgeIdle(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "info.log")
+	old := time.Now().AddDate(0, 0, -8)
+	for i := 1; i <= 2; i++ {
+		name := fmt.Sprintf("%s.%d", path, i)
+		if err := ioutil.WriteFile(name, []byte(name), 0664); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(name, old, old)
+	}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	hook := NewLfsHook(path, nil)
+	hook.MaxAge = 50 * time.Millisecond
+	logger.AddHook(hook)
+	defer hook.Close()
+
+	// no rotation, the stale backups are removed in background
+	logger.Info("this is info")
+	deadline := time.Now().Add(2 * time.Second)
+	for _, err := os.Stat(path + ".2"); !os.IsNotExist(err); _, err = os.Stat(path + ".2") {
+		if time.Now().After(deadline) {
+			t.Fatal("stale backups should be removed by the idle hook")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := os.Stat(path + ".1"); !os.IsNotExist(err) {
+		t.Fatal("stale backups should be removed")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	dir := t.TempDir()
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	path := filepath.Join(dir, "info.log")
+	hook := NewLfsHook(path, nil)
+	defer hook.Close()
+
+	entry := logrus.NewEntry(logger)
+	entry.Level = logrus.InfoLevel
+	entry.Message = "this is info"
+	if err := hook.Fire(entry); err != nil {
+		t.Fatal(err)
+	}
+	// break the opened file under the hook
+	hook.fls[path].fd.Close()
+	if err := hook.Fire(entry); err == nil {
+		t.Fatal("write error should be returned")
+	}
+	if err := hook.Fire(entry); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPathTemplate(t *testing.T) {
+	dir := t.TempDir()
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	hook := NewLfsHook(filepath.Join(dir, "%Y", "app-%Y-%m-%d.log"), nil)
+	logger.AddHook(hook)
+	defer hook.Close()
+
+	now := time.Now()
+	logger.Info("this is info")
+	path := filepath.Join(dir, now.Format("2006"), "app-"+now.Format("2006-01-02")+".log")
+	if _, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := expandPath("app-%Y%m%d%H%M.log", now); got != "app-"+now.Format("200601021504")+".log" {
+		t.Fatalf("unexpected path: %s", got)
+	}
+	if got := expandPath("app.log", now); got != "app.log" {
+		t.Fatalf("unexpected path: %s", got)
+	}
+}
+
+func TestBuffer(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "info.log")
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	hook := NewLfsHook(path, nil)
+	hook.BufferSize = 4096
+	defer hook.Close()
+
+	entry := logrus.NewEntry(logger)
+	entry.Level = logrus.InfoLevel
+	entry.Message = "this is info"
+	if err := hook.Fire(entry); err != nil {
+		t.Fatal(err)
+	}
+	if bts, _ := ioutil.ReadFile(path); len(bts) > 0 {
+		t.Fatalf("entry should be buffered: %s", bts)
+	}
+	if err := hook.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if bts, _ := ioutil.ReadFile(path); !strings.Contains(string(bts), "this is info") {
+		t.Fatalf("entry should be flushed: %s", bts)
+	}
+
+	entry.Level = logrus.FatalLevel
+	entry.Message = "this is fatal"
+	if err := hook.Fire(entry); err != nil {
+		t.Fatal(err)
+	}
+	if bts, _ := ioutil.ReadFile(path); !strings.Contains(string(bts), "this is fatal") {
+		t.Fatalf("fatal entry should be flushed: %s", bts)
+	}
+}
+
+func TestSetFormatterClone(t *testing.T) {
+	formatter := &logrus.TextFormatter{ForceColors: true, FullTimestamp: true}
+	hook := NewLfsHook(ioutil.Discard, formatter)
+	if formatter.DisableColors {
+		t.Fatal("caller's formatter should not be changed")
+	}
+	tf, ok := hook.formatter.(*logrus.TextFormatter)
+	if !ok || tf == formatter {
+		t.Fatal("formatter should be cloned")
+	}
+	if !tf.DisableColors || !tf.FullTimestamp {
+		t.Fatalf("unexpected cloned formatter: %+v", tf)
+	}
+
+	// the caller's formatter still colors the output, e.g. for stdout
+	entry := logrus.NewEntry(logrus.New())
+	entry.Message = "this is info"
+	if bts, _ := formatter.Format(entry); !strings.Contains(string(bts), "\x1b[") {
+		t.Fatalf("caller's output should be colored: %q", bts)
+	}
+	if bts, _ := tf.Format(entry); strings.Contains(string(bts), "\x1b[") {
+		t.Fatalf("hook's output should not be colored: %q", bts)
+	}
+}
+
+func TestLevels(t *testing.T) {
+	hook := NewLfsHook(WriterMap{
+		logrus.InfoLevel:  ioutil.Discard,
+		logrus.ErrorLevel: ioutil.Discard,
+	}, nil)
+	if len(hook.Levels()) != 2 {
+		t.Fatalf("unexpected levels: %v", hook.Levels())
+	}
+	hook.SetDefaultWriter(ioutil.Discard)
+	if len(hook.Levels()) != len(logrus.AllLevels) {
+		t.Fatalf("unexpected levels: %v", hook.Levels())
+	}
+	hook.SetLevels([]logrus.Level{logrus.WarnLevel})
+	if lvs := hook.Levels(); len(lvs) != 1 || lvs[0] != logrus.WarnLevel {
+		t.Fatalf("unexpected levels: %v", lvs)
+	}
+}
+
+func TestMaxAgeDaily(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "info.log")
+	old := time.Now().AddDate(0, 0, -8)
+	names := []string{
+		path + "-" + old.Format("2006-01-02"),
+		path + "-" + old.Format("2006-01-02") + ".1.gz",
+		path + "-other",
+	}
+	for _, name := range names {
+		if err := ioutil.WriteFile(name, []byte(name), 0664); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(name, old, old)
+	}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	hook := NewLfsHook(path, nil, 10, 5)
+	hook.MaxAge = 7 * 24 * time.Hour
+	logger.AddHook(hook)
+	defer hook.Close()
+
+	logger.Info("this is info")
+	logger.Info("this is info")
+
+	for _, name := range names[:2] {
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Fatalf("%s should be removed", name)
+		}
+	}
+	if _, err := os.Stat(names[2]); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReopen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "info.log")
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	hook := NewLfsHook(path, nil)
+	hook.BufferSize = 4096
+	logger.AddHook(hook)
+	defer hook.Close()
+
+	logger.Info("before reopen")
+	if err := os.Rename(path, path+".old"); err != nil {
+		t.Fatal(err)
+	}
+	if err := hook.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("after reopen")
+	hook.Flush()
+
+	if bts, _ := ioutil.ReadFile(path + ".old"); !strings.Contains(string(bts), "before reopen") {
+		t.Fatalf("buffered entry should be kept: %s", bts)
+	}
+	if bts, _ := ioutil.ReadFile(path); !strings.Contains(string(bts), "after reopen") {
+		t.Fatalf("file should be reopened: %s", bts)
+	}
+}
+
+func TestNewLfsHookWithOptions(t *testing.T) {
+	dir := t.TempDir()
+	hook, err := NewLfsHookWithOptions(filepath.Join(dir, "info.log"),
+		WithFormatter(&logrus.JSONFormatter{}),
+		WithMaxSize(1024*1024),
+		WithMaxBackups(7),
+		WithMaxAge(7*24*time.Hour),
+		WithCompress(true),
+		WithFileMode(0600),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hook.Close()
+	if hook.FdMaxSize != 1024*1024 || hook.FdMaxLen != 7 || hook.MaxAge != 7*24*time.Hour || !hook.Compress || hook.FileMode != 0600 {
+		t.Fatalf("unexpected hook: %+v", hook)
+	}
+
+	if _, err := NewLfsHookWithOptions(1); err == nil {
+		t.Fatal("unsupported output should return error")
+	}
+}
+
+func TestOnRotate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "info.log")
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	hook := NewLfsHook(path, nil, 10, 5)
+	// logrus locks the logger while firing hooks, so use another one inside the callback
+	other := logrus.New()
+	other.Out = ioutil.Discard
+	other.AddHook(hook)
+	var rotated []string
+	hook.OnRotate = func(level logrus.Level, oldPath, newPath string, size int64) {
+		if oldPath != path || size <= 10 {
+			t.Errorf("unexpected rotation: %v %s %s %d", level, oldPath, newPath, size)
+		}
+		if level == logrus.InfoLevel {
+			// logging with the hook inside the callback must not deadlock
+			other.Warn("rotated")
+			rotated = append(rotated, newPath)
+		}
+	}
+	logger.AddHook(hook)
+	defer hook.Close()
+
+	logger.Info("this is info")
+	logger.Info("this is info")
+	if len(rotated) != 1 || rotated[0] != path+".1" {
+		t.Fatalf("unexpected rotations: %v", rotated)
+	}
+}
+
+func TestNewLfsHookE(t *testing.T) {
+	if _, err := NewLfsHookE(1, nil); err == nil || !strings.Contains(err.Error(), "int") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	hook, err := NewLfsHookE(ioutil.Discard, nil, 1024, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hook.FdMaxSize != 1024 || hook.FdMaxLen != 3 {
+		t.Fatalf("unexpected hook: %d %d", hook.FdMaxSize, hook.FdMaxLen)
+	}
+}
+
+func TestMaxSize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "info.log")
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	hook := NewLfsHook(path, &logrus.TextFormatter{DisableTimestamp: true}, 100, 50)
+	logger.AddHook(hook)
+
+	for i := 0; i < 20; i++ {
+		logger.Info("this is info")
+	}
+	logger.Info(strings.Repeat("x", 200))
+	logger.Info("this is info")
+	hook.Close()
+
+	fls, _ := filepath.Glob(path + "*")
+	for _, name := range fls {
+		stat, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bts, _ := ioutil.ReadFile(name)
+		if stat.Size() > 100 && strings.Count(string(bts), "\n") > 1 {
+			t.Fatalf("%s exceeds the max size: %d", name, stat.Size())
+		}
+	}
+}
+
+func TestSymlink(t *testing.T) {
+	dir := t.TempDir()
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	hook := NewLfsHook(filepath.Join(dir, "info.log"), nil)
+	hook.Symlink = ".current"
+	logger.AddHook(hook)
+	defer hook.Close()
+
+	logger.Info("this is info")
+	bts, err := ioutil.ReadFile(filepath.Join(dir, "info.current"))
+	if err != nil {
+		t.Skip("symlink is not supported:", err)
+	}
+	if !strings.Contains(string(bts), "this is info") {
+		t.Fatalf("unexpected content: %s", bts)
+	}
+}
+
+func TestSymlinkTemplate(t *testing.T) {
+	for tmpl, want := range map[string]string{
+		"info.log":                  "info.current",
+		"app-%Y-%m-%d.log":          "app.current",
+		"logs/%Y/%m/app_%Y%m%d.log": "logs/app.current",
+		"logs/info.%Y%m%d%H%M.log":  "logs/info.current",
+		"logs/%Y-%m-%d/info.log":    "logs/info.current",
+	} {
+		if got := linkPath(filepath.FromSlash(tmpl), ".current"); got != filepath.FromSlash(want) {
+			t.Fatalf("unexpected link of %s: %s, expected %s", tmpl, got, want)
+		}
+	}
+
+	dir := t.TempDir()
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	hook := NewLfsHook(filepath.Join(dir, "app-%Y-%m-%d.log"), nil)
+	hook.Symlink = ".current"
+	logger.AddHook(hook)
+	defer hook.Close()
+
+	logger.Info("this is info")
+	bts, err := ioutil.ReadFile(filepath.Join(dir, "app.current"))
+	if err != nil {
+		t.Skip("symlink is not supported:", err)
+	}
+	if !strings.Contains(string(bts), "this is info") {
+		t.Fatalf("unexpected content: %s", bts)
+	}
+}
+
+func TestQueue(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "info.log")
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	hook := NewLfsHook(path, nil)
+	hook.QueueSize = 16
+	logger.AddHook(hook)
+
+	for i := 0; i < 100; i++ {
+		logger.Info("this is info")
+	}
+	if err := hook.Close(); err != nil {
+		t.Fatal(err)
+	}
+	bts, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(bts), "this is info"); n != 100 {
+		t.Fatalf("unexpected entry count: %d", n)
+	}
+	if hook.Dropped() != 0 {
+		t.Fatalf("unexpected dropped count: %d", hook.Dropped())
+	}
+}
+
+func TestQueueDrop(t *testing.T) {
+	for _, policy := range []QueuePolicy{QueueDropOldest, QueueDropNewest} {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "info.log")
+		logger := logrus.New()
+		logger.Out = ioutil.Discard
+		hook := NewLfsHook(path, nil)
+		hook.QueueSize = 1
+		hook.QueuePolicy = policy
+		logger.AddHook(hook)
+
+		for i := 0; i < 1000; i++ {
+			logger.Info("this is info")
+		}
+		if err := hook.Close(); err != nil {
+			t.Fatal(err)
+		}
+		bts, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := uint64(strings.Count(string(bts), "this is info")); n+hook.Dropped() != 1000 {
+			t.Fatalf("unexpected entry count: %d + %d", n, hook.Dropped())
+		}
+	}
+}
+
+func BenchmarkFireLevels(b *testing.B) {
+	dir, err := ioutil.TempDir("", "lfshook")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	levels := []logrus.Level{logrus.ErrorLevel, logrus.WarnLevel, logrus.InfoLevel, logrus.DebugLevel}
+	pmp := PathMap{}
+	for _, level := range levels {
+		pmp[level] = filepath.Join(dir, level.String()+".log")
+	}
+	hook := NewLfsHook(pmp, nil)
+	defer hook.Close()
+	logger := logrus.New()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			entry := logrus.NewEntry(logger)
+			entry.Level = levels[i%len(levels)]
+			entry.Message = "this is a benchmark"
+			hook.Fire(entry)
+		}
+	})
+}
+
+func TestAsyncBuffer(t *testing.T) {
+	dir := t.TempDir()
+	pmp := PathMap{
+		logrus.InfoLevel:  filepath.Join(dir, "info.log"),
+		logrus.ErrorLevel: filepath.Join(dir, "error.log"),
+	}
+	hook, err := NewLfsHookWithOptions(pmp, WithQueue(8, QueueBlock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+
+	for i := 0; i < 100; i++ {
+		logger.Info("this is info")
+		logger.Error("this is error")
+	}
+	if err := hook.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for level, path := range pmp {
+		bts, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := strings.Count(string(bts), "this is "+level.String()); n != 100 {
+			t.Fatalf("unexpected entry count of %s: %d", path, n)
+		}
+	}
+}
+
+type closeWriter struct {
+	closed int
+	err    error
+}
+
+func (w *closeWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (w *closeWriter) Close() error {
+	w.closed++
+	return w.err
+}
+
+func TestCloseWriters(t *testing.T) {
+	shared := &closeWriter{}
+	hook := NewLfsHook(WriterMap{
+		logrus.InfoLevel:  shared,
+		logrus.ErrorLevel: shared,
+		logrus.WarnLevel:  ioutil.Discard,
+	}, nil)
+	hook.CloseWriters = true
+	if err := hook.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if shared.closed != 1 {
+		t.Fatalf("unexpected close count: %d", shared.closed)
+	}
+}
+
+func TestOwnWriters(t *testing.T) {
+	w1 := &closeWriter{err: errors.New("close error 1")}
+	w2 := &closeWriter{err: errors.New("close error 2")}
+	hook, err := NewLfsHookWithOptions(WriterMap{
+		logrus.InfoLevel:  w1,
+		logrus.ErrorLevel: w2,
+	}, WithOwnWriters())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = hook.Close()
+	if err == nil || !strings.Contains(err.Error(), "close error 1") || !strings.Contains(err.Error(), "close error 2") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if w1.closed != 1 || w2.closed != 1 {
+		t.Fatalf("unexpected close count: %d %d", w1.closed, w2.closed)
+	}
+}
+
+func TestLevelFormatter(t *testing.T) {
+	dir := t.TempDir()
+	pmp := PathMap{
+		logrus.InfoLevel:  filepath.Join(dir, "info.log"),
+		logrus.ErrorLevel: filepath.Join(dir, "error.log"),
+	}
+	text := &logrus.TextFormatter{ForceColors: true}
+	hook, err := NewLfsHookWithOptions(pmp, WithFormatterMap(FormatterMap{
+		logrus.ErrorLevel: &logrus.JSONFormatter{},
+		logrus.InfoLevel:  text,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	logger.Info("this is info")
+	logger.Error("this is error")
+	hook.Close()
+
+	if text.DisableColors {
+		t.Fatal("caller's formatter should not be changed")
+	}
+	if bts, _ := ioutil.ReadFile(pmp[logrus.ErrorLevel]); !strings.HasPrefix(string(bts), "{") {
+		t.Fatalf("error log should be json: %s", bts)
+	}
+	if bts, _ := ioutil.ReadFile(pmp[logrus.InfoLevel]); !strings.HasPrefix(string(bts), "time=") {
+		t.Fatalf("info log should be plain text: %s", bts)
+	}
+}
+
+func TestLevelFormatterWriter(t *testing.T) {
+	var info, errs strings.Builder
+	hook, err := NewLfsHookWithOptions(WriterMap{
+		logrus.InfoLevel:  &info,
+		logrus.ErrorLevel: &errs,
+	}, WithFormatterMap(FormatterMap{
+		logrus.ErrorLevel: &logrus.JSONFormatter{},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	logger.Info("this is info")
+	logger.Error("this is error")
+
+	if !strings.HasPrefix(errs.String(), "{") {
+		t.Fatalf("error log should be json: %s", errs.String())
+	}
+	if !strings.HasPrefix(info.String(), "time=") {
+		t.Fatalf("info log should be plain text: %s", info.String())
+	}
+}
+
+func TestBufferRotate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "info.log")
+	hook, err := NewLfsHookWithOptions(path, WithMaxSize(1024), WithMaxBackups(3), WithBuffer(4096, time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+
+	// the buffered bytes count towards the size, so the files rotate before flushing
+	for i := 0; i < 100; i++ {
+		logger.Info("this is info")
+	}
+	if err := hook.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{path, path + ".1", path + ".2", path + ".3"} {
+		stat, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stat.Size() <= 0 || stat.Size() > 1024 {
+			t.Fatalf("unexpected size of %s: %d", name, stat.Size())
+		}
+	}
+}
+
+func TestStats(t *testing.T) {
+	dir := t.TempDir()
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	hook := NewLfsHook(filepath.Join(dir, "info.log"), nil, 10, 5)
+	logger.AddHook(hook)
+	defer hook.Close()
+
+	for i := 0; i < 3; i++ {
+		logger.Info("this is info")
+	}
+	logger.Warn("this is warning")
+	st := hook.Stats()
+	if st.LinesWritten != 4 || st.Rotations != 3 || st.WriteErrors != 0 || st.BytesWritten <= 0 {
+		t.Fatalf("unexpected stats: %+v", st)
+	}
+	if len(st.LevelBytes) != 2 || st.LevelBytes[logrus.InfoLevel]+st.LevelBytes[logrus.WarnLevel] != st.BytesWritten {
+		t.Fatalf("unexpected level stats: %+v", st.LevelBytes)
+	}
+}
+
+func TestLargeEntry(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "info.log")
+	hook := NewLfsHook(path, nil, 1024, 5)
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	defer hook.Close()
+
+	for i := 0; i < 10; i++ {
+		logger.Info("this is info")
+	}
+	logger.Info(strings.Repeat("x", 2048))
+	logger.Info("this is info")
+
+	for _, name := range []string{path + ".1", path + ".2"} {
+		stat, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name == path+".1" && stat.Size() > 1024 {
+			t.Fatalf("unexpected size of %s: %d", name, stat.Size())
+		}
+		if name == path+".2" && stat.Size() <= 2048 {
+			t.Fatalf("the large entry should be in %s: %d", name, stat.Size())
+		}
+	}
+	if bts, _ := ioutil.ReadFile(path); strings.Contains(string(bts), "xxx") {
+		t.Fatalf("the large entry should be rotated: %s", bts)
+	}
+}
+
+func TestFileHeader(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "info.log")
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	hook, err := NewLfsHookWithOptions(path, WithMaxSize(10), WithMaxBackups(5), WithFileHeader(func() []byte {
+		return []byte("# header\n")
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.AddHook(hook)
+
+	logger.Info("this is info")
+	logger.Info("this is info")
+	hook.Close()
+	// the reopened file isn't empty, no header is written
+	hook.SetMaxSize(1024)
+	logger.Info("this is warn")
+	hook.Close()
+	if bts, _ := ioutil.ReadFile(path); strings.Count(string(bts), "# header") != 1 || !strings.Contains(string(bts), "this is warn") {
+		t.Fatalf("unexpected content of the reopened file: %s", bts)
+	}
+
+	for _, name := range []string{path, path + ".1"} {
+		bts, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(bts), "# header\n") || strings.Count(string(bts), "this is info") != 1 {
+			t.Fatalf("unexpected content of %s: %s", name, bts)
+		}
+	}
+}
+
+type errFormatter struct{}
+
+func (errFormatter) Format(*logrus.Entry) ([]byte, error) {
+	return nil, errors.New("format error")
+}
+
+func TestOnError(t *testing.T) {
+	var errs []error
+	hook := NewLfsHook(ioutil.Discard, errFormatter{})
+	hook.OnError = func(err error, entry *logrus.Entry) {
+		if entry == nil || entry.Message != "this is info" {
+			t.Errorf("unexpected entry: %v", entry)
+		}
+		errs = append(errs, err)
+	}
+	entry := logrus.NewEntry(logrus.New())
+	entry.Level = logrus.InfoLevel
+	entry.Message = "this is info"
+	if err := hook.Fire(entry); err == nil {
+		t.Fatal("format error should be returned")
+	}
+	if len(errs) != 1 || errs[0].Error() != "format error" {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+}
+
+func TestAddPathConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	hook := NewLfsHook(PathMap{logrus.InfoLevel: filepath.Join(dir, "info.log")}, nil)
+	defer hook.Close()
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.SetLevel(logrus.DebugLevel)
+	logger.AddHook(hook)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			logger.Info("this is info")
+			logger.Debug("this is debug")
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		hook.AddPath(logrus.DebugLevel, filepath.Join(dir, fmt.Sprintf("debug%d.log", i%2)))
+		hook.AddPath(logrus.InfoLevel, filepath.Join(dir, fmt.Sprintf("info%d.log", i%2)))
+	}
+	wg.Wait()
+	if len(hook.Levels()) != 2 {
+		t.Fatalf("unexpected levels: %v", hook.Levels())
+	}
+}
+
+func TestFireLevelsConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	levels := []logrus.Level{logrus.ErrorLevel, logrus.WarnLevel, logrus.InfoLevel, logrus.DebugLevel}
+	pmp := PathMap{}
+	for _, level := range levels {
+		pmp[level] = filepath.Join(dir, level.String()+".log")
+	}
+	hook := NewLfsHook(pmp, nil, 1024, 100)
+	logger := logrus.New()
+
+	var wg sync.WaitGroup
+	for _, level := range levels {
+		wg.Add(1)
+		go func(level logrus.Level) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				entry := logrus.NewEntry(logger)
+				entry.Level = level
+				entry.Message = "this is " + level.String()
+				if err := hook.Fire(entry); err != nil {
+					t.Error(err)
+				}
+			}
+		}(level)
+	}
+	wg.Wait()
+	hook.Close()
+
+	for level, path := range pmp {
+		n := 0
+		fls, _ := filepath.Glob(path + "*")
+		for _, name := range fls {
+			bts, _ := ioutil.ReadFile(name)
+			n += strings.Count(string(bts), "this is "+level.String())
+		}
+		if n != 200 {
+			t.Fatalf("unexpected entry count of %s: %d", path, n)
+		}
+	}
+}
+
+func BenchmarkFireLevel(b *testing.B) {
+	dir, err := ioutil.TempDir("", "lfshook")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	hook := NewLfsHook(filepath.Join(dir, "info.log"), nil)
+	defer hook.Close()
+	logger := logrus.New()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			entry := logrus.NewEntry(logger)
+			entry.Level = logrus.InfoLevel
+			entry.Message = "this is a benchmark"
+			hook.Fire(entry)
+		}
+	})
+}
+
+type archiveRotator struct {
+	Rotator
+	dir string
+	n   int
+}
+
+func (r *archiveRotator) Rotate(path string) (string, error) {
+	r.n++
+	name := filepath.Join(r.dir, fmt.Sprintf("%s.%d", filepath.Base(path), r.n))
+	return name, os.Rename(path, name)
+}
+
+func TestRotator(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "info.log")
+	hook := NewLfsHook(path, nil, 10, 5)
+	archive := filepath.Join(dir, "archive")
+	os.Mkdir(archive, 0755)
+	hook.Rotator = &archiveRotator{Rotator: hook.DefaultRotator(), dir: archive}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	defer hook.Close()
+
+	for i := 0; i < 3; i++ {
+		logger.Info("this is info")
+	}
+	for i := 1; i <= 2; i++ {
+		if _, err := os.Stat(filepath.Join(archive, fmt.Sprintf("info.log.%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(path + ".1"); !os.IsNotExist(err) {
+		t.Fatal("default rotation should not be used")
+	}
+}
+
+func TestSetLevelsFire(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	hook := NewLfsHook(path, nil)
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	defer hook.Close()
+
+	hook.SetLevels([]logrus.Level{logrus.ErrorLevel})
+	logger.Info("this is info")
+	logger.Error("this is error")
+	bts, _ := ioutil.ReadFile(path)
+	if strings.Contains(string(bts), "this is info") || !strings.Contains(string(bts), "this is error") {
+		t.Fatalf("unexpected content: %s", bts)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	hook := NewLfsHook(path, nil)
+	hook.FileHeader = func() []byte { return []byte("# header\n") }
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	defer hook.Close()
+
+	logger.Info("this is info")
+	logger.Error("this is error")
+	if err := hook.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	// the new file is opened at once
+	if bts, _ := ioutil.ReadFile(path); string(bts) != "# header\n" {
+		t.Fatalf("unexpected content of the new file: %q", bts)
+	}
+	logger.Info("after rotate")
+
+	bts, err := ioutil.ReadFile(path + ".1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(bts), "this is info") || !strings.Contains(string(bts), "this is error") {
+		t.Fatalf("unexpected rotated content: %s", bts)
+	}
+	if _, err := os.Stat(path + ".2"); !os.IsNotExist(err) {
+		t.Fatal("shared file should be rotated once")
+	}
+	if bts, _ := ioutil.ReadFile(path); !strings.Contains(string(bts), "after rotate") {
+		t.Fatalf("unexpected content: %s", bts)
+	}
+}
+
+func TestReopenOnChange(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "info.log")
+	hook := NewLfsHook(path, nil)
+	hook.ReopenOnChange = true
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	defer hook.Close()
+
+	logger.Info("before move")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	hook.fls[path].checkedAt = time.Time{}
+	logger.Info("after move")
+
+	if bts, _ := ioutil.ReadFile(path); !strings.Contains(string(bts), "after move") {
+		t.Fatalf("file should be reopened: %s", bts)
+	}
+}
+
+func TestReopenRemoved(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "info.log")
+	hook, err := NewLfsHookWithOptions(path, WithReopenOnChange(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	defer hook.Close()
+
+	logger.Info("before remove")
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	logger.Info("after remove")
+
+	if bts, _ := ioutil.ReadFile(path); !strings.Contains(string(bts), "after remove") {
+		t.Fatalf("file should be reopened: %s", bts)
+	}
+}
+
+func TestManifest(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "info.log")
+	hook := NewLfsHook(path, nil, 10, 5)
+	hook.Manifest = true
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+
+	logger.Info("this is info")
+	logger.Info("this is info")
+	hook.Rotate()
+	hook.Close()
+
+	bts, err := ioutil.ReadFile(path + ".manifest.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(bts)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("unexpected manifest: %s", bts)
+	}
+	for i, reason := range []string{"size", "manual"} {
+		var rc ManifestRecord
+		if err := json.Unmarshal([]byte(lines[i]), &rc); err != nil {
+			t.Fatal(err)
+		}
+		if rc.File != fmt.Sprintf("%s.%d", path, i+1) || rc.Reason != reason || rc.Size <= 0 || rc.First.IsZero() {
+			t.Fatalf("unexpected record: %+v", rc)
+		}
+	}
+}
+
+func TestOnErrorLogging(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "info.log")
+	// the manifest can't be written over a directory
+	if err := os.Mkdir(path+".manifest.jsonl", 0755); err != nil {
+		t.Fatal(err)
+	}
+	hook := NewLfsHook(path, nil, 10, 5)
+	hook.Manifest = true
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	var reported int
+	hook.OnError = func(err error, entry *logrus.Entry) {
+		reported++
+		if reported == 1 {
+			logger.Info("this is an error: " + err.Error())
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		logger.Info("this is info")
+		logger.Info("this is info")
+		hook.Rotate()
+		hook.Close()
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("logging inside OnError is blocked")
+	}
+	if reported == 0 {
+		t.Fatal("expected the manifest errors")
+	}
+}
+
+func TestOnErrorLoggingWriter(t *testing.T) {
+	info := &strings.Builder{}
+	hook := NewLfsHook(WriterMap{
+		logrus.InfoLevel:  info,
+		logrus.ErrorLevel: &flakyWriter{fails: 1, err: syscall.EBADF},
+	}, nil)
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	hook.OnError = func(err error, entry *logrus.Entry) {
+		logger.Info("this is an error: " + err.Error())
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		logger.Error("this is error")
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("logging inside OnError is blocked")
+	}
+	if !strings.Contains(info.String(), "this is an error") {
+		t.Fatalf("unexpected output: %q", info.String())
+	}
+}
+
+func TestOnErrorLoggingCompress(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "info.log")
+	// the backup can't be compressed over a directory
+	if err := os.Mkdir(path+".1.gz", 0755); err != nil {
+		t.Fatal(err)
+	}
+	hook := NewLfsHook(path, nil, 10, 5)
+	hook.Compress = true
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	var reported int32
+	logged := make(chan struct{})
+	hook.OnError = func(err error, entry *logrus.Entry) {
+		if atomic.AddInt32(&reported, 1) == 1 {
+			logger.Info("this is an error: " + err.Error())
+			close(logged)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		logger.Info("this is info")
+		logger.Info("this is info")
+		hook.Close()
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("logging inside OnError is blocked")
+	}
+	// the error is reported after the compression is done
+	select {
+	case <-logged:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the compress error")
+	}
+	hook.Close()
+}
+
+func TestManifestCompress(t *testing.T) {
+	for _, active := range []bool{false, true} {
+		path := filepath.Join(t.TempDir(), "info.log")
+		opts := []Option{WithCompress(true)}
+		if active {
+			path += ".gz"
+			opts = append(opts, WithCompressActive())
+		}
+		hook, err := NewLfsHookWithOptions(path, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hook.Manifest = true
+		logger := logrus.New()
+		logger.Out = ioutil.Discard
+		logger.AddHook(hook)
+
+		logger.Info("this is info")
+		hook.Rotate()
+		hook.Close()
+
+		bts, err := ioutil.ReadFile(path + ".manifest.jsonl")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rc ManifestRecord
+		if err := json.Unmarshal(bts, &rc); err != nil {
+			t.Fatal(err)
+		}
+		want := path + ".1"
+		if !active {
+			want += ".gz"
+		}
+		if rc.File != want {
+			t.Fatalf("unexpected file of the record: %s, expected %s", rc.File, want)
+		}
+		if _, err := os.Stat(rc.File); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the failed compression keeps the backup's name
+	path := filepath.Join(t.TempDir(), "info.log")
+	if err := os.Mkdir(path+".1.gz", 0755); err != nil {
+		t.Fatal(err)
+	}
+	hook, err := NewLfsHookWithOptions(path, WithCompress(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hook.Manifest = true
+	hook.OnError = func(err error, entry *logrus.Entry) {}
+	hook.Fire(&logrus.Entry{Logger: logrus.New(), Level: logrus.InfoLevel, Message: "this is info"})
+	hook.Rotate()
+	hook.Close()
+	bts, err := ioutil.ReadFile(path + ".manifest.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rc ManifestRecord
+	if err := json.Unmarshal(bts, &rc); err != nil {
+		t.Fatal(err)
+	}
+	if rc.File != path+".1" {
+		t.Fatalf("unexpected file of the record: %s", rc.File)
+	}
+}
+
+func TestLevelDir(t *testing.T) {
+	dir := t.TempDir()
+	hook := NewLfsHook(LevelDir(dir), nil)
+	hook.AddPath(logrus.WarnLevel, filepath.Join(dir, "other.log"))
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	defer hook.Close()
+
+	logger.Info("this is info")
+	logger.Error("this is error")
+	logger.Warn("this is warning")
+	for _, name := range []string{"info.log", "error.log", "other.log"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "warning.log")); !os.IsNotExist(err) {
+		t.Fatal("the defined path should be used")
+	}
+}
+
+type errWriter struct{}
+
+func (errWriter) Write(p []byte) (int, error) { return 0, errors.New("write error") }
+
+func TestMultiWriterMap(t *testing.T) {
+	var b1, b2 strings.Builder
+	hook := NewLfsHook(MultiWriterMap{
+		logrus.ErrorLevel: {&b1, errWriter{}, &b2},
+	}, nil)
+	entry := logrus.NewEntry(logrus.New())
+	entry.Level = logrus.ErrorLevel
+	entry.Message = "this is error"
+	if err := hook.Fire(entry); err == nil || err.Error() != "write error" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(b1.String(), "this is error") || b1.String() != b2.String() {
+		t.Fatalf("unexpected content: %q %q", b1.String(), b2.String())
+	}
+}
+
+func TestBackupGaps(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "info.log")
+	for _, n := range []int{1, 3, 5} {
+		name := fmt.Sprintf("%s.%d", path, n)
+		if err := ioutil.WriteFile(name, []byte(name), 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hook := NewLfsHook(path, nil, 10, 3)
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	defer hook.Close()
+
+	logger.Info("this is info")
+	logger.Info("this is info")
+
+	for i, want := range []string{path + ".3", path + ".5", "this is info"} {
+		bts, err := ioutil.ReadFile(fmt.Sprintf("%s.%d", path, i+1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(bts), want) {
+			t.Fatalf("unexpected content of backup %d: %s", i+1, bts)
+		}
+	}
+	for _, n := range []int{4, 5} {
+		if _, err := os.Stat(fmt.Sprintf("%s.%d", path, n)); !os.IsNotExist(err) {
+			t.Fatalf("backup %d should not exist", n)
+		}
+	}
+}
+
+func TestFieldRoute(t *testing.T) {
+	dir := t.TempDir()
+	hook, err := NewLfsHookWithOptions(filepath.Join(dir, "default.log"), WithFieldRoute("tenant", func(value string) string {
+		if value == "" {
+			return ""
+		}
+		return filepath.Join(dir, value+".log")
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hook.MaxRouteFiles = 2
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	defer hook.Close()
+
+	for _, tenant := range []string{"a", "b", "c", "a"} {
+		logger.WithField("tenant", tenant).Info("this is " + tenant)
+	}
+	logger.Info("this is default")
+	for name, want := range map[string]string{"a.log": "this is a", "b.log": "this is b", "c.log": "this is c", "default.log": "this is default"} {
+		bts, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(bts), want) {
+			t.Fatalf("unexpected content of %s: %s", name, bts)
+		}
+	}
+	bts, err := ioutil.ReadFile(filepath.Join(dir, "a.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(bts), "this is a"); n != 2 {
+		t.Fatalf("unexpected count of a.log: %d", n)
+	}
+	hook.flk.Lock()
+	n := len(hook.routes)
+	hook.flk.Unlock()
+	if n != 2 {
+		t.Fatalf("unexpected count of opened routes: %d", n)
+	}
+}
+
+func TestContext(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "info.log")
+	ctx, cancel := context.WithCancel(context.Background())
+	hook, err := NewLfsHookWithOptions(path, WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := logrus.NewEntry(logrus.New())
+	entry.Level = logrus.InfoLevel
+	entry.Message = "this is info"
+	if err := hook.Fire(entry); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	entry.Message = "this is canceled"
+	if err := hook.Fire(entry); err != context.Canceled {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	bts, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(bts), "this is info") || strings.Contains(string(bts), "this is canceled") {
+		t.Fatalf("unexpected content: %s", bts)
+	}
+	for i := 0; ; i++ {
+		hook.flk.Lock()
+		n := len(hook.fls)
+		hook.flk.Unlock()
+		if n == 0 {
+			break
+		}
+		if i >= 100 {
+			t.Fatal("the log files should be closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMaxLines(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "info.log")
+	hook, err := NewLfsHookWithOptions(path, WithMaxLines(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	defer hook.Close()
+
+	for i := 0; i < 5; i++ {
+		logger.Infof("this is info %d", i)
+	}
+	for name, want := range map[string]int{path + ".2": 2, path + ".1": 2, path: 1} {
+		bts, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := strings.Count(string(bts), "\n"); n != want {
+			t.Fatalf("unexpected line count of %s: %d", name, n)
+		}
+	}
+}
+
+func TestBackupNameFunc(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "info.log")
+	var times []time.Time
+	hook, err := NewLfsHookWithOptions(path, WithMaxSize(10), WithMaxBackups(2), WithBackupName(func(path string, t time.Time) string {
+		times = append(times, t)
+		return strings.TrimSuffix(path, ".log") + t.Format("-20060102-1504.log")
+	}, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	defer hook.Close()
+
+	for i := 0; i < 4; i++ {
+		logger.Infof("this is info %d", i)
+		time.Sleep(10 * time.Millisecond)
+	}
+	baks, err := filepath.Glob(filepath.Join(dir, "info-*.log*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(baks) != 2 {
+		t.Fatalf("unexpected backups: %v", baks)
+	}
+	for _, tm := range times {
+		if tm.Location() != time.UTC {
+			t.Fatalf("the time should be in UTC: %v", tm)
+		}
+	}
+	bts, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(bts), "this is info 3") {
+		t.Fatalf("unexpected content: %s", bts)
+	}
+}
+
+func TestBackupIndexName(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	name := func(path string, index int) string {
+		return fmt.Sprintf("%s-%06d.log", strings.TrimSuffix(path, ".log"), index)
+	}
+	hook, err := NewLfsHookWithOptions(path, WithMaxSize(10), WithMaxBackups(2), WithBackupIndexName(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	defer hook.Close()
+
+	for i := 0; i < 4; i++ {
+		logger.Infof("this is info %d", i)
+	}
+	for i, want := range []string{"this is info 1", "this is info 2"} {
+		bts, err := ioutil.ReadFile(filepath.Join(dir, fmt.Sprintf("app-%06d.log", i+1)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(bts), want) {
+			t.Fatalf("unexpected content of backup %d: %s", i+1, bts)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "app-000003.log")); !os.IsNotExist(err) {
+		t.Fatal("backup 3 should not exist")
+	}
+}
+
+func TestSharedPath(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	hook := NewLfsHook(PathMap{
+		logrus.InfoLevel:  path,
+		logrus.WarnLevel:  path,
+		logrus.ErrorLevel: path,
+	}, nil, 1024, 5)
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	defer hook.Close()
+
+	for i := 0; i < 20; i++ {
+		logger.Info("this is info")
+		logger.Warn("this is warning")
+		logger.Error("this is error")
+	}
+	if n := len(hook.fls); n != 1 {
+		t.Fatalf("the levels should share one file: %d", n)
+	}
+	baks, _ := filepath.Glob(path + ".*")
+	if len(baks) < 2 {
+		t.Fatalf("unexpected backups: %v", baks)
+	}
+	for _, name := range append(baks, path) {
+		stat, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stat.Size() > 1024 {
+			t.Fatalf("unexpected size of %s: %d", name, stat.Size())
+		}
+	}
+}
+
+func TestCombined(t *testing.T) {
+	dir := t.TempDir()
+	pmp := PathMap{
+		logrus.InfoLevel:  filepath.Join(dir, "info.log"),
+		logrus.ErrorLevel: filepath.Join(dir, "error.log"),
+	}
+	all := filepath.Join(dir, "all.log")
+	hook, err := NewLfsHookWithOptions(pmp, WithCombined(all))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	defer hook.Close()
+
+	logger.Info("this is info")
+	logger.Error("this is error")
+	logger.Warn("this is warning")
+
+	bts, err := ioutil.ReadFile(all)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(bts)), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[0], "this is info") || !strings.Contains(lines[2], "this is warning") {
+		t.Fatalf("unexpected content: %s", bts)
+	}
+	if bts, _ := ioutil.ReadFile(pmp[logrus.ErrorLevel]); strings.Count(string(bts), "\n") != 1 {
+		t.Fatalf("unexpected content of error.log: %s", bts)
+	}
+
+	// the writer outputs are combined too
+	w := &strings.Builder{}
+	whook, err := NewLfsHookWithOptions(w, WithRawMode(), WithCombined(all))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer whook.Close()
+	whook.Fire(&logrus.Entry{Logger: logger, Level: logrus.InfoLevel, Message: "this is writer"})
+	if bts, _ := ioutil.ReadFile(all); w.String() != "this is writer\n" || !strings.Contains(string(bts), "this is writer") {
+		t.Fatalf("unexpected content: %q, %q", w.String(), bts)
+	}
+}
+
+func TestSetMaxSize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "info.log")
+	hook := NewLfsHook(path, nil)
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	defer hook.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				logger.Info("this is info")
+			}
+		}()
+	}
+	hook.SetMaxSize(1024)
+	hook.SetMaxBackups(2)
+	wg.Wait()
+
+	logger.Info("this is info")
+	baks, _ := filepath.Glob(path + ".*")
+	if len(baks) != 2 {
+		t.Fatalf("unexpected backups: %v", baks)
+	}
+}
+
+func TestThreshold(t *testing.T) {
+	dir := t.TempDir()
+	pmp := PathMap{
+		logrus.WarnLevel:  filepath.Join(dir, "warn.log"),
+		logrus.DebugLevel: filepath.Join(dir, "debug.log"),
+	}
+	hook, err := NewLfsHookWithOptions(pmp, WithThreshold())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if levels := hook.Levels(); len(levels) != int(logrus.DebugLevel)+1 {
+		t.Fatalf("unexpected levels: %v", levels)
+	}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.SetLevel(logrus.TraceLevel)
+	logger.AddHook(hook)
+	defer hook.Close()
+
+	logger.Error("this is error")
+	logger.Warn("this is warning")
+	logger.Info("this is info")
+	logger.Trace("this is trace")
+
+	bts, _ := ioutil.ReadFile(pmp[logrus.WarnLevel])
+	if !strings.Contains(string(bts), "this is error") || !strings.Contains(string(bts), "this is warning") || strings.Contains(string(bts), "this is info") {
+		t.Fatalf("unexpected content of warn.log: %s", bts)
+	}
+	bts, _ = ioutil.ReadFile(pmp[logrus.DebugLevel])
+	if strings.Count(string(bts), "\n") != 1 || !strings.Contains(string(bts), "this is info") {
+		t.Fatalf("unexpected content of debug.log: %s", bts)
+	}
+}
+
+func TestMaxTotalSize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "info.log")
+	hook, err := NewLfsHookWithOptions(path, WithMaxSize(1024), WithMaxBackups(100), WithMaxTotalSize(4096))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	defer hook.Close()
+
+	for i := 0; i < 200; i++ {
+		logger.Info("this is info")
+	}
+	baks, _ := filepath.Glob(path + ".*")
+	if len(baks) < 2 {
+		t.Fatalf("unexpected backups: %v", baks)
+	}
+	var total int64
+	for _, name := range baks {
+		stat, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		total += stat.Size()
+	}
+	if total > 4096 {
+		t.Fatalf("unexpected total size of backups: %d", total)
+	}
+}
+
+type fakeSyslog struct {
+	msgs []string
+}
+
+func (s *fakeSyslog) write(prio, m string) error {
+	s.msgs = append(s.msgs, prio+" "+m)
+	return nil
+}
+func (s *fakeSyslog) Emerg(m string) error   { return s.write("emerg", m) }
+func (s *fakeSyslog) Crit(m string) error    { return s.write("crit", m) }
+func (s *fakeSyslog) Err(m string) error     { return s.write("err", m) }
+func (s *fakeSyslog) Warning(m string) error { return s.write("warning", m) }
+func (s *fakeSyslog) Info(m string) error    { return s.write("info", m) }
+func (s *fakeSyslog) Debug(m string) error   { return s.write("debug", m) }
+
+func TestSyslog(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	sl := &fakeSyslog{}
+	hook, err := NewLfsHookWithOptions(path, WithSyslog(sl))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.SetLevel(logrus.TraceLevel)
+	logger.AddHook(hook)
+	defer hook.Close()
+
+	logger.Error("this is error")
+	logger.Warn("this is warning")
+	logger.Trace("this is trace")
+
+	if len(sl.msgs) != 3 {
+		t.Fatalf("unexpected syslog: %v", sl.msgs)
+	}
+	for i, prio := range []string{"err ", "warning ", "debug "} {
+		if !strings.HasPrefix(sl.msgs[i], prio) {
+			t.Fatalf("unexpected priority: %s", sl.msgs[i])
+		}
+	}
+	if bts, _ := ioutil.ReadFile(path); strings.Count(string(bts), "\n") != 3 {
+		t.Fatalf("unexpected content: %s", bts)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	hook := NewLfsHook(PathMap{
+		logrus.InfoLevel: filepath.Join(dir, "logs", "info.log"),
+	}, nil)
+	if err := hook.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "logs")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "logs", "info.log")); !os.IsNotExist(err) {
+		t.Fatal("the validated file should be removed")
+	}
+
+	file := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(file, nil, 0664); err != nil {
+		t.Fatal(err)
+	}
+	hook.AddPath(logrus.ErrorLevel, filepath.Join(file, "error.log"))
+	if err := hook.Validate(); err == nil || !strings.Contains(err.Error(), "level error") {
+		t.Fatalf("the path under a file should be invalid: %v", err)
+	}
+
+	if _, err := NewLfsHookE(PathMap{logrus.WarnLevel: ""}, nil); err == nil || !strings.Contains(err.Error(), "warning") {
+		t.Fatalf("the empty path should be invalid: %v", err)
+	}
+	if _, err := NewLfsHookE(WriterMap{logrus.WarnLevel: nil}, nil); err == nil || !strings.Contains(err.Error(), "warning") {
+		t.Fatalf("the nil writer should be invalid: %v", err)
+	}
+}
+
+func BenchmarkFireAllocs(b *testing.B) {
+	dir, err := ioutil.TempDir("", "lfshook")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	hook := NewLfsHook(filepath.Join(dir, "info.log"), nil)
+	defer hook.Close()
+	entry := logrus.NewEntry(logrus.New())
+	entry.Level = logrus.InfoLevel
+	entry.Message = "this is a benchmark"
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		hook.Fire(entry)
+	}
+}
+
+func TestSyncInterval(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "info.log")
+	hook, err := NewLfsHookWithOptions(path, WithBuffer(4096, time.Hour), WithSyncInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+
+	logger.Info("this is info")
+	for i := 0; ; i++ {
+		if bts, _ := ioutil.ReadFile(path); strings.Contains(string(bts), "this is info") {
+			break
+		}
+		if i >= 100 {
+			t.Fatal("the buffered entry should be synced")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := hook.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if hook.sstop != nil {
+		t.Fatal("the sync ticker should be stopped")
+	}
+}
+
+func TestSyncOnWrite(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+	hook, err := NewLfsHookWithOptions(path, WithBuffer(4096, time.Hour), WithSyncOnWrite())
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	defer hook.Close()
+
+	logger.Info("this is audit")
+	if bts, _ := ioutil.ReadFile(path); !strings.Contains(string(bts), "this is audit") {
+		t.Fatalf("the entry should be written when Fire returns: %s", bts)
+	}
+}
+
+func TestRotateUpload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "info.log")
+	var (
+		mu       sync.Mutex
+		uploaded []string
+	)
+	hook, err := NewLfsHookWithOptions(path, WithMaxSize(10), WithMaxBackups(10), WithCompress(true),
+		WithRotateUpload(func(path string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			uploaded = append(uploaded, path)
+			return errors.New("upload error")
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errs []error
+	hook.OnError = func(err error, entry *logrus.Entry) {
+		errs = append(errs, err)
+	}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+
+	for i := 0; i < 3; i++ {
+		logger.Info("this is info")
+	}
+	if err := hook.Close(); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(uploaded) != 2 || len(errs) != 2 {
+		t.Fatalf("unexpected uploads: %v %v", uploaded, errs)
+	}
+	for _, name := range uploaded {
+		if !strings.HasSuffix(name, compressSuffix) {
+			t.Fatalf("the compressed file should be uploaded: %s", name)
+		}
+		if _, err := os.Stat(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSizeCheckWrites(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "info.log")
+	var loggers []*logrus.Logger
+	for i := 0; i < 2; i++ {
+		hook, err := NewLfsHookWithOptions(path, WithMaxSize(1024), WithMaxBackups(100),
+			WithSizeCheck(1), WithReopenOnChange(time.Nanosecond))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer hook.Close()
+		logger := logrus.New()
+		logger.Out = ioutil.Discard
+		logger.AddHook(hook)
+		loggers = append(loggers, logger)
+	}
+
+	for i := 0; i < 100; i++ {
+		loggers[i%2].Info("this is info")
+	}
+	fls, _ := filepath.Glob(path + "*")
+	if len(fls) < 3 {
+		t.Fatalf("unexpected files: %v", fls)
+	}
+	for _, name := range fls {
+		stat, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stat.Size() > 1024 {
+			t.Fatalf("unexpected size of %s: %d", name, stat.Size())
+		}
+	}
+}
+
+func TestFallbackWriter(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(file, nil, 0664); err != nil {
+		t.Fatal(err)
+	}
+	var fallback strings.Builder
+	hook, err := NewLfsHookWithOptions(PathMap{
+		logrus.ErrorLevel: filepath.Join(file, "error.log"),
+	}, WithFallbackWriter(&fallback))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hook.OnError = func(err error, entry *logrus.Entry) {}
+	entry := logrus.NewEntry(logrus.New())
+	entry.Level = logrus.ErrorLevel
+	entry.Message = "this is error"
+	if err := hook.Fire(entry); err == nil {
+		t.Fatal("the file error should be returned")
+	}
+	if !strings.Contains(fallback.String(), "this is error") {
+		t.Fatalf("the entry should be written to the fallback: %q", fallback.String())
+	}
+}
+
+func TestRawMode(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "info.log")
+	var b strings.Builder
+	for _, output := range []interface{}{path, &b} {
+		hook, err := NewLfsHookWithOptions(output, WithRawMode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		logger := logrus.New()
+		logger.Out = ioutil.Discard
+		logger.AddHook(hook)
+		logger.WithField("key", "value").Info(`{"msg":"this is raw"}`)
+		logger.Info("this is raw\n")
+		hook.Close()
+	}
+
+	want := "{\"msg\":\"this is raw\"}\nthis is raw\n"
+	if bts, _ := ioutil.ReadFile(path); string(bts) != want {
+		t.Fatalf("unexpected file content: %q", bts)
+	}
+	if b.String() != want {
+		t.Fatalf("unexpected writer content: %q", b.String())
+	}
+}
+
+func TestMinRotateInterval(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "info.log")
+	hook, err := NewLfsHookWithOptions(path, WithMaxSize(10), WithMaxBackups(10), WithMinRotateInterval(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clk := &fakeClock{t: time.Now()}
+	hook.setClock(clk)
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	defer hook.Close()
+
+	for i := 0; i < 5; i++ {
+		logger.Info("this is info")
+	}
+	if baks, _ := filepath.Glob(path + ".*"); len(baks) != 1 {
+		t.Fatalf("unexpected backups: %v", baks)
+	}
+	clk.add(time.Minute)
+	logger.Info("this is info")
+	if baks, _ := filepath.Glob(path + ".*"); len(baks) != 2 {
+		t.Fatalf("unexpected backups: %v", baks)
+	}
+}
+
+func TestSample(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "error.log")
+	hook, err := NewLfsHookWithOptions(path, WithSample(2, time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clk := &fakeClock{t: time.Now()}
+	hook.setClock(clk)
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	defer hook.Close()
+
+	for i := 0; i < 10; i++ {
+		logger.Error("this is error")
+	}
+	logger.Info("this is info")
+	clk.add(time.Second)
+	logger.Error("this is error")
+
+	bts, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(bts), "this is error"); n != 3 {
+		t.Fatalf("unexpected count of errors: %d\n%s", n, bts)
+	}
+	if !strings.Contains(string(bts), "this is info") || !strings.Contains(string(bts), "suppressed 8 entries") {
+		t.Fatalf("unexpected content: %s", bts)
+	}
+}
+
+func TestPathFor(t *testing.T) {
+	hook := NewLfsHook(PathMap{
+		logrus.ErrorLevel: "logs/error-%Y%m%d.log",
+	}, nil)
+	hook.setClock(&fakeClock{t: time.Date(2024, 1, 2, 15, 4, 0, 0, time.Local)})
+	if path, ok := hook.PathFor(logrus.ErrorLevel); !ok || path != "logs/error-20240102.log" {
+		t.Fatalf("unexpected path: %s", path)
+	}
+	if _, ok := hook.PathFor(logrus.InfoLevel); ok {
+		t.Fatal("info level should not have a path")
+	}
+	hook.SetDefaultPath("logs/app.log")
+	if path, ok := hook.PathFor(logrus.InfoLevel); !ok || path != "logs/app.log" {
+		t.Fatalf("unexpected path: %s", path)
+	}
+	if _, ok := NewLfsHook(ioutil.Discard, nil).PathFor(logrus.InfoLevel); ok {
+		t.Fatal("the writer should not have a path")
+	}
+}
+
+func TestDedupeConsecutive(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "info.log")
+	hook, err := NewLfsHookWithOptions(path, WithDedupeConsecutive())
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+
+	for i := 0; i < 5; i++ {
+		logger.Info("this is info")
+	}
+	logger.Warn("this is warning")
+	for i := 0; i < 3; i++ {
+		logger.Warn("this is warning")
+	}
+	if err := hook.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	bts, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(bts)), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("unexpected content: %s", bts)
+	}
+	for i, want := range []string{"this is info", "repeated 4 times", "this is warning", "repeated 3 times"} {
+		if !strings.Contains(lines[i], want) {
+			t.Fatalf("unexpected line %d: %s", i, lines[i])
+		}
+	}
+}
+
+func TestDedupeClosedFile(t *testing.T) {
+	dir := t.TempDir()
+	hook, err := NewLfsHookWithOptions(PathMap{logrus.InfoLevel: filepath.Join(dir, "info.log")}, WithDedupeConsecutive(), WithFieldRoute("tenant", func(value string) string {
+		return filepath.Join(dir, value+".log")
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hook.MaxRouteFiles = 1
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+
+	// the routed file is evicted by another tenant
+	for i := 0; i < 3; i++ {
+		logger.WithField("tenant", "a").Info("this is a")
+	}
+	logger.WithField("tenant", "b").Info("this is b")
+
+	// the file of the level is replaced by AddPath
+	for i := 0; i < 4; i++ {
+		logger.Info("this is info")
+	}
+	hook.AddPath(logrus.InfoLevel, filepath.Join(dir, "other.log"))
+	if err := hook.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{"a.log": "repeated 2 times", "info.log": "repeated 3 times"} {
+		bts, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(bts), want) {
+			t.Fatalf("unexpected content of %s: %s", name, bts)
+		}
+	}
+}
+
+type rotWriter struct {
+	segments []*strings.Builder
+}
+
+func (w *rotWriter) Write(p []byte) (int, error) {
+	if len(w.segments) == 0 {
+		w.segments = append(w.segments, &strings.Builder{})
+	}
+	return w.segments[len(w.segments)-1].Write(p)
+}
+func (w *rotWriter) Rotate() error {
+	w.segments = append(w.segments, &strings.Builder{})
+	return nil
+}
+
+func TestRotatingWriter(t *testing.T) {
+	w := &rotWriter{}
+	hook, err := NewLfsHookWithOptions(w, WithMaxSize(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+
+	for i := 0; i < 10; i++ {
+		logger.Info("this is info")
+	}
+	if len(w.segments) < 3 {
+		t.Fatalf("unexpected segments: %d", len(w.segments))
+	}
+	for i := range w.segments {
+		if n := w.segments[i].Len(); n <= 0 || n > 100 {
+			t.Fatalf("unexpected size of segment %d: %d", i, n)
+		}
+	}
+	if st := hook.Stats(); st.Rotations != uint64(len(w.segments)-1) {
+		t.Fatalf("unexpected rotations: %d", st.Rotations)
+	}
+}
+
+func TestDefaultFields(t *testing.T) {
+	var b1, b2 strings.Builder
+	hook, err := NewLfsHookWithOptions(&b1, WithDefaultFields(logrus.Fields{"service": "api", "host": "h1"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := NewLfsHook(&b2, nil)
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	logger.AddHook(other)
+
+	logger.WithField("host", "h2").Info("this is info")
+	if !strings.Contains(b1.String(), "service=api") || !strings.Contains(b1.String(), "host=h2") {
+		t.Fatalf("unexpected content: %s", b1.String())
+	}
+	if strings.Contains(b2.String(), "service=") || !strings.Contains(b2.String(), "host=h2") {
+		t.Fatalf("the fields should not leak to other hooks: %s", b2.String())
+	}
+}
+
+func TestPause(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "info.log")
+	hook := NewLfsHook(path, nil)
+	hook.PauseBuffer = 2
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	defer hook.Close()
+
+	logger.Info("before pause")
+	if err := hook.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(path, path+".old"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		logger.WithField("i", i).Info("while paused")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("the file should not be written while paused")
+	}
+	if err := hook.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("after resume")
+
+	bts, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(bts), "while paused") != 2 || !strings.Contains(string(bts), "i=1") || !strings.Contains(string(bts), "after resume") {
+		t.Fatalf("unexpected content: %s", bts)
+	}
+	if st := hook.Stats(); st.DroppedEntries != 1 {
+		t.Fatalf("unexpected dropped entries: %d", st.DroppedEntries)
+	}
+}
+
+func TestPauseQueue(t *testing.T) {
+	if !flockSupported {
+		t.Skip("flock is not supported")
+	}
+	path := filepath.Join(t.TempDir(), "info.log")
+	hook, err := NewLfsHookWithOptions(path, WithRawMode(), WithQueue(128, QueueBlock), WithMultiProcess())
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	defer hook.Close()
+
+	// the entries wait in the queue while another process holds the lock
+	lock, err := os.OpenFile(path+lockSuffix, os.O_CREATE|os.O_RDWR, 0664)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := flock(lock); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		logger.Info("before pause")
+	}
+	paused := make(chan struct{})
+	go func() {
+		defer close(paused)
+		hook.Pause()
+	}()
+	time.Sleep(50 * time.Millisecond)
+	lock.Close()
+	<-paused
+
+	if err := os.Rename(path, path+".old"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("the file should not be written while paused")
+	}
+	if bts, _ := ioutil.ReadFile(path + ".old"); strings.Count(string(bts), "before pause") != 100 {
+		t.Fatalf("unexpected content: %q", bts)
+	}
+}
+
+func TestPauseSampling(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "info.log")
+	hook, err := NewLfsHookWithOptions(path, WithRawMode(), WithSampling(logrus.InfoLevel, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hook.PauseBuffer = 10
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	defer hook.Close()
+
+	hook.Pause()
+	for i := 0; i < 4; i++ {
+		logger.Info("while paused")
+	}
+	if err := hook.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	if bts, _ := ioutil.ReadFile(path); strings.Count(string(bts), "while paused") != 2 {
+		t.Fatalf("the kept entries should be sampled once: %q", bts)
+	}
+}
+
+func TestFileGetConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "info.log")
+	hook := NewLfsHook(path, nil)
+	defer hook.Close()
+
+	fes := make([]*lfsFile, 64)
+	var wg sync.WaitGroup
+	for i := range fes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			fes[i] = hook.fileGet(logrus.InfoLevel, path)
+			entry := logrus.NewEntry(logrus.New())
+			entry.Level = logrus.InfoLevel
+			entry.Message = "this is info"
+			hook.Fire(entry)
+		}(i)
+	}
+	wg.Wait()
+	for _, fe := range fes {
+		if fe != fes[0] {
+			t.Fatal("exactly one file should be created for the level")
+		}
+	}
+	bts, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(bts), "\n"); n != len(fes) || int64(len(bts)) != fes[0].ln {
+		t.Fatalf("unexpected lines %d, size %d of %d", n, fes[0].ln, len(bts))
+	}
+}
+
+func TestMaxLineBytes(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "info.log")
+	var b strings.Builder
+	for _, output := range []interface{}{path, &b} {
+		hook, err := NewLfsHookWithOptions(output, WithRawMode(), WithMaxLineBytes(10))
+		if err != nil {
+			t.Fatal(err)
+		}
+		logger := logrus.New()
+		logger.Out = ioutil.Discard
+		logger.AddHook(hook)
+		logger.Info("short")
+		logger.Info("0123456789abcdef")
+		logger.Info("012345678é")
+		hook.Close()
+	}
+
+	want := "short\n0123456789...[truncated 6 bytes]\n012345678...[truncated 2 bytes]\n"
+	// the newline doesn't count toward the limit
+	if got := string(truncateMsg([]byte("0123456789\n"), 10)); got != "0123456789\n" {
+		t.Fatalf("unexpected entry at the limit: %q", got)
+	}
+	if bts, _ := ioutil.ReadFile(path); string(bts) != want {
+		t.Fatalf("unexpected file content: %q", bts)
+	}
+	if b.String() != want {
+		t.Fatalf("unexpected writer content: %q", b.String())
+	}
+}
+
+type bareFormatter struct{}
+
+func (bareFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	return []byte(entry.Message), nil
+}
+
+func TestEnsureNewline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "info.log")
+	hook, err := NewLfsHookWithOptions(path, WithFormatter(bareFormatter{}), WithEnsureNewline())
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	logger.Info("one")
+	logger.Info("two\n")
+	hook.Close()
+
+	if bts, _ := ioutil.ReadFile(path); string(bts) != "one\ntwo\n" {
+		t.Fatalf("unexpected content: %q", bts)
+	}
+}
+
+func TestMultiProcess(t *testing.T) {
+	if !flockSupported {
+		t.Skip("flock is not supported")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	// the hooks open their own descriptors like two processes
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		hook, err := NewLfsHookWithOptions(path, WithRawMode(), WithMultiProcess(), WithMaxSize(1024), WithMaxBackups(100))
+		if err != nil {
+			t.Fatal(err)
+		}
+		logger := logrus.New()
+		logger.Out = ioutil.Discard
+		logger.AddHook(hook)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer hook.Close()
+			for j := 0; j < 200; j++ {
+				logger.Info("this is a line of the process")
+			}
+		}()
+	}
+	wg.Wait()
+
+	names, _ := filepath.Glob(path + "*")
+	lines := 0
+	for _, name := range names {
+		if strings.HasSuffix(name, lockSuffix) {
+			continue
+		}
+		bts, _ := ioutil.ReadFile(name)
+		for _, line := range strings.SplitAfter(string(bts), "\n") {
+			if line == "" {
+				continue
+			}
+			if line != "this is a line of the process\n" {
+				t.Fatalf("interleaved line in %s: %q", name, line)
+			}
+			lines++
+		}
+	}
+	if lines != 400 {
+		t.Fatalf("expected 400 lines, got %d in %v", lines, names)
+	}
+}
+
+func TestOpenFlags(t *testing.T) {
+	hook := &LfsHook{}
+	if flags := hook.openFlags(); flags != os.O_CREATE|os.O_APPEND|os.O_RDWR {
+		t.Fatalf("unexpected default flags: %x", flags)
+	}
+	hook.OpenFlags = os.O_SYNC | os.O_TRUNC
+	if flags := hook.openFlags(); flags != os.O_CREATE|os.O_APPEND|os.O_RDWR|os.O_SYNC {
+		t.Fatalf("unexpected flags: %x", flags)
+	}
+
+	path := filepath.Join(t.TempDir(), "info.log")
+	if err := ioutil.WriteFile(path, []byte("old\n"), 0664); err != nil {
+		t.Fatal(err)
+	}
+	hook, err := NewLfsHookWithOptions(path, WithRawMode(), WithOpenFlags(os.O_WRONLY|os.O_SYNC|os.O_TRUNC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	logger.Info("new")
+	hook.Close()
+	if bts, _ := ioutil.ReadFile(path); string(bts) != "old\nnew\n" {
+		t.Fatalf("unexpected content: %q", bts)
+	}
+}
+
+func TestRotateCopyTruncate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "info.log")
+	hook, err := NewLfsHookWithOptions(path, WithRawMode(), WithMaxSize(10), WithRotateMode(RotateCopyTruncate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hook.Close()
+	hook.FileHeader = func() []byte { return []byte("#\n") }
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	logger.Info("first")
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("second")
+	logger.Info("third")
+	hook.Flush()
+
+	after, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(before, after) {
+		t.Fatal("the active file should keep its inode")
+	}
+	for name, want := range map[string]string{
+		path:        "#\nthird\n",
+		path + ".1": "#\nfirst\n",
+		path + ".2": "#\nsecond\n",
+	} {
+		if bts, _ := ioutil.ReadFile(name); string(bts) != want {
+			t.Fatalf("unexpected content of %s: %q", name, bts)
+		}
+	}
+}
+
+func gunzipFile(t *testing.T, name string) string {
+	fl, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fl.Close()
+	zr, err := gzip.NewReader(fl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bts, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", name, err)
+	}
+	return string(bts)
+}
+
+func TestCompressActive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "info.log.gz")
+	hook, err := NewLfsHookWithOptions(path, WithRawMode(), WithCompressActive(), WithMaxSize(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	logger.Info("first")
+	logger.Info("second")
+	if stat, err := os.Stat(path); err != nil || stat.Size() == 0 {
+		t.Fatalf("the entries should be flushed: %v", err)
+	}
+	logger.Info(strings.Repeat("x", 200))
+	logger.Info("third")
+	hook.Close()
+	// a reopened file gets a new member
+	logger.Info("fourth")
+	hook.Close()
+
+	// the rotation is decided by the compressed size, the long entry rotates the file once
+	if s := gunzipFile(t, path+".1"); s != "first\nsecond\n" {
+		t.Fatalf("unexpected backup: %q", s)
+	}
+	if s := gunzipFile(t, path); s != strings.Repeat("x", 200)+"\nthird\nfourth\n" {
+		t.Fatalf("unexpected active file: %q", s)
+	}
+}
+
+func TestNewTestHook(t *testing.T) {
+	hook, output := NewTestHook()
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	logger.Info("this is info")
+	logger.Warn("this is warn")
+
+	if s := output(logrus.InfoLevel); !strings.Contains(s, "this is info") || strings.Contains(s, "this is warn") {
+		t.Fatalf("unexpected info output: %q", s)
+	}
+	if s := output(logrus.WarnLevel); !strings.Contains(s, "this is warn") {
+		t.Fatalf("unexpected warn output: %q", s)
+	}
+	if s := output(logrus.ErrorLevel); s != "" {
+		t.Fatalf("unexpected error output: %q", s)
+	}
+}
+
+func TestRotateStress(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "info.log")
+	hook, err := NewLfsHookWithOptions(path, WithRawMode(), WithMaxSize(4096), WithMaxBackups(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+
+	const goroutines, lines = 50, 200
+	stop := make(chan struct{})
+	rotated := make(chan struct{})
+	go func() {
+		defer close(rotated)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			hook.Rotate()
+			hook.Reopen()
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < lines; i++ {
+				logger.Infof("%d-%d", g, i)
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(stop)
+	<-rotated
+	hook.Close()
+
+	seen := make(map[string]int)
+	names, _ := filepath.Glob(path + "*")
+	for _, name := range names {
+		bts, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range strings.Split(strings.TrimSuffix(string(bts), "\n"), "\n") {
+			if line != "" {
+				seen[line]++
+			}
+		}
+	}
+	for g := 0; g < goroutines; g++ {
+		for i := 0; i < lines; i++ {
+			if line := fmt.Sprintf("%d-%d", g, i); seen[line] != 1 {
+				t.Fatalf("line %s is written %d times", line, seen[line])
+			}
+		}
+	}
+	if len(seen) != goroutines*lines {
+		t.Fatalf("expected %d lines, got %d", goroutines*lines, len(seen))
+	}
+}
+
+func TestUnlimitedSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "info.log")
+	hook := NewLfsHook(path, nil)
+	hook.SetMaxSize(0)
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	for i := 0; i < 100; i++ {
+		logger.Info("this is info")
+	}
+	hook.SetMaxSize(-1)
+	logger.Info("this is info")
+	hook.Close()
+
+	if _, err := os.Stat(path + ".1"); !os.IsNotExist(err) {
+		t.Fatal("the file should never be rotated")
+	}
+	if bts, _ := ioutil.ReadFile(path); strings.Count(string(bts), "this is info") != 101 {
+		t.Fatalf("unexpected content: %s", bts)
+	}
+}
+
+func TestTemplateClock(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 1, 2, 23, 59, 0, 0, time.Local)
+	hook := NewLfsHook(filepath.Join(dir, "app-%Y-%m-%d.log"), nil)
+	hook.setClock(clockFunc(func() time.Time { return now }))
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	defer hook.Close()
+
+	logger.Info("yesterday")
+	now = now.Add(2 * time.Minute)
+	logger.Info("today")
+	hook.Flush()
+
+	for name, want := range map[string]string{"app-2024-01-02.log": "yesterday", "app-2024-01-03.log": "today"} {
+		bts, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Count(string(bts), "msg=") != 1 || !strings.Contains(string(bts), want) {
+			t.Fatalf("unexpected content of %s: %s", name, bts)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "info.log")
+	run := func(msg string, opts ...Option) {
+		hook, err := NewLfsHookWithOptions(path, append(opts, WithRawMode())...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		logger := logrus.New()
+		logger.Out = ioutil.Discard
+		logger.AddHook(hook)
+		logger.Info(msg)
+		hook.Close()
+		// the reopened file isn't truncated again
+		logger.Info(msg)
+		hook.Close()
+	}
+	run("one")
+	run("two")
+	if bts, _ := ioutil.ReadFile(path); string(bts) != "one\none\ntwo\ntwo\n" {
+		t.Fatalf("unexpected appended content: %q", bts)
+	}
+	run("three", WithTruncate())
+	if bts, _ := ioutil.ReadFile(path); string(bts) != "three\nthree\n" {
+		t.Fatalf("unexpected truncated content: %q", bts)
+	}
+}
+
+func TestCurrentFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "info.log")
+	hook := NewLfsHook(PathMap{logrus.InfoLevel: path}, nil)
+	if got, ok := hook.CurrentPath(logrus.InfoLevel); !ok || got != path {
+		t.Fatalf("unexpected path: %s %v", got, ok)
+	}
+	if size := hook.CurrentSize(logrus.InfoLevel); size != 0 {
+		t.Fatalf("unexpected size of the missing file: %d", size)
+	}
+	if _, ok := hook.CurrentPath(logrus.WarnLevel); ok {
+		t.Fatal("the warn level isn't written to a file")
+	}
+	if size := hook.CurrentSize(logrus.WarnLevel); size != -1 {
+		t.Fatalf("unexpected size of the warn level: %d", size)
+	}
+
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	logger.Info("this is info")
+	stat, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := hook.CurrentSize(logrus.InfoLevel); size != stat.Size() {
+		t.Fatalf("expected size %d, got %d", stat.Size(), size)
+	}
+	hook.Close()
+	if size := hook.CurrentSize(logrus.InfoLevel); size != stat.Size() {
+		t.Fatalf("expected size %d of the closed file, got %d", stat.Size(), size)
+	}
+}
+
+func TestFileAndWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "info.log")
+	var b strings.Builder
+	hook, err := NewLfsHookWithOptions(path, WithRawMode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hook.SetDefaultWriter(&b)
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	logger.Info("this is info")
+	hook.Close()
+
+	if bts, _ := ioutil.ReadFile(path); string(bts) != "this is info\n" {
+		t.Fatalf("unexpected file content: %q", bts)
+	}
+	if b.String() != "this is info\n" {
+		t.Fatalf("unexpected writer content: %q", b.String())
+	}
+	if got, ok := hook.PathFor(logrus.InfoLevel); !ok || got != path {
+		t.Fatalf("unexpected path: %s %v", got, ok)
+	}
+}
+
+func TestSetSampling(t *testing.T) {
+	hook, output := NewTestHook()
+	hook.SetFormatter(rawFormatter{})
+	hook.SetSampling(logrus.DebugLevel, 3)
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.SetLevel(logrus.DebugLevel)
+	logger.AddHook(hook)
+	for i := 0; i < 7; i++ {
+		logger.Debugf("debug %d", i)
+		logger.Infof("info %d", i)
+	}
+
+	if s := output(logrus.DebugLevel); s != "debug 0\ndebug 3\ndebug 6\n" {
+		t.Fatalf("unexpected debug output: %q", s)
+	}
+	if s := output(logrus.InfoLevel); strings.Count(s, "\n") != 7 {
+		t.Fatalf("unexpected info output: %q", s)
+	}
+	if n := hook.Stats().SampledOut; n != 4 {
+		t.Fatalf("expected 4 sampled out, got %d", n)
+	}
+}
+
+func TestNewJSONLfsHook(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "info.log")
+	hook := NewJSONLfsHook(path, 200)
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	for i := 0; i < 3; i++ {
+		logger.WithField("nested", map[string]int{"i": i}).Info("this is info")
+	}
+	hook.Close()
+
+	bts, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(bts), "\n"), "\n")
+	if _, err := os.Stat(path + ".1"); err != nil {
+		t.Fatal("the file should be rotated by size")
+	}
+	for _, line := range lines {
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &m); err != nil || m["msg"] != "this is info" {
+			t.Fatalf("unexpected line %q: %v", line, err)
+		}
+	}
+}
+
+func TestFireContext(t *testing.T) {
+	if !flockSupported {
+		t.Skip("flock is not supported")
+	}
+	path := filepath.Join(t.TempDir(), "info.log")
+	hook, err := NewLfsHookWithOptions(path, WithRawMode(), WithQueue(1, QueueBlock), WithMultiProcess())
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := hook.FireContext(ctx, logrus.NewEntry(logger)); err != context.Canceled {
+		t.Fatalf("expected the canceled error, got %v", err)
+	}
+
+	// the queue is stuck while another process holds the lock
+	lock, err := os.OpenFile(path+lockSuffix, os.O_CREATE|os.O_RDWR, 0664)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := flock(lock); err != nil {
+		t.Fatal(err)
+	}
+	timeouts := 0
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		entry := logrus.NewEntry(logger)
+		entry.Level = logrus.InfoLevel
+		entry.Message = "this is info"
+		if err := hook.FireContext(ctx, entry); err == context.DeadlineExceeded {
+			timeouts++
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+	}
+	lock.Close()
+	hook.Close()
+
+	if timeouts == 0 || hook.Dropped() != uint64(timeouts) {
+		t.Fatalf("expected the blocked entries to be dropped, %d timeouts, %d dropped", timeouts, hook.Dropped())
+	}
+	if bts, _ := ioutil.ReadFile(path); strings.Count(string(bts), "this is info") != 3-timeouts {
+		t.Fatalf("unexpected content: %q", bts)
+	}
+}
+
+func TestQueueStuckFile(t *testing.T) {
+	if !flockSupported {
+		t.Skip("flock is not supported")
+	}
+	dir := t.TempDir()
+	pmp := PathMap{
+		logrus.InfoLevel:  filepath.Join(dir, "info.log"),
+		logrus.ErrorLevel: filepath.Join(dir, "error.log"),
+	}
+	hook, err := NewLfsHookWithOptions(pmp, WithRawMode(), WithQueue(1, QueueBlock), WithMultiProcess())
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+
+	// the info queue is full while another process holds the lock of its file
+	lock, err := os.OpenFile(pmp[logrus.InfoLevel]+lockSuffix, os.O_CREATE|os.O_RDWR, 0664)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := flock(lock); err != nil {
+		t.Fatal(err)
+	}
+	blocked := make(chan struct{})
+	go func() {
+		defer close(blocked)
+		for i := 0; i < 3; i++ {
+			entry := logrus.NewEntry(logger)
+			entry.Level = logrus.InfoLevel
+			entry.Message = "this is info"
+			hook.Fire(entry)
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	fired := make(chan struct{})
+	go func() {
+		defer close(fired)
+		entry := logrus.NewEntry(logger)
+		entry.Level = logrus.ErrorLevel
+		entry.Message = "this is error"
+		hook.Fire(entry)
+	}()
+	select {
+	case <-fired:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the error entry is blocked by the info queue")
+	}
+	lock.Close()
+	<-blocked
+	hook.Close()
+
+	for level, path := range pmp {
+		n := 1
+		if level == logrus.InfoLevel {
+			n = 3
+		}
+		if bts, _ := ioutil.ReadFile(path); strings.Count(string(bts), "this is "+level.String()) != n {
+			t.Fatalf("unexpected content of %s: %q", path, bts)
+		}
+	}
+}
+
+func TestQueueCallbackLogging(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "info.log")
+	hook, err := NewLfsHookWithOptions(path, WithRawMode(), WithQueue(1, QueueBlock), WithMaxSize(200))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	hook.OnRotate = func(level logrus.Level, oldPath, newPath string, size int64) {
+		for i := 0; i < 3; i++ {
+			logger.Info("this is rotated")
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			logger.Info("this is info")
+		}
+		hook.Close()
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("logging inside OnRotate is blocked")
+	}
+}
+
+func TestQueueRoutes(t *testing.T) {
+	dir := t.TempDir()
+	hook, err := NewLfsHookWithOptions(filepath.Join(dir, "info.log"), WithQueue(8, QueueBlock), WithFieldRoute("tenant", func(value string) string {
+		return filepath.Join(dir, value+".log")
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hook.MaxRouteFiles = 2
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+
+	for i := 0; i < 10; i++ {
+		logger.WithField("tenant", fmt.Sprint(i)).Info("this is info")
+	}
+	logger.Info("this is info")
+	hook.lock.Lock()
+	n := len(hook.queues)
+	hook.lock.Unlock()
+	if n != 2 {
+		t.Fatalf("expected the routed files to share a queue, got %d queues", n)
+	}
+	if err := hook.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if bts, _ := ioutil.ReadFile(filepath.Join(dir, fmt.Sprintf("%d.log", i))); !strings.Contains(string(bts), "this is info") {
+			t.Fatalf("unexpected content of %d.log: %q", i, bts)
+		}
+	}
+}
+
+func TestMkdirError(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("the permissions are ignored for root")
+	}
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0555); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(dir, 0755)
+	path := filepath.Join(dir, "logs", "info.log")
+	hook := NewLfsHook(path, nil)
+	var errs []error
+	hook.OnError = func(err error, entry *logrus.Entry) {
+		errs = append(errs, err)
+	}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	logger.Info("this is info")
+	hook.Close()
+
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "failed to create the directory of "+path) {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+}
+
+func readFrames(t *testing.T, bts []byte) []string {
+	var frames []string
+	for len(bts) > 0 {
+		if len(bts) < frameLengthSize {
+			t.Fatalf("truncated frame header: %q", bts)
+		}
+		n := int(binary.BigEndian.Uint32(bts))
+		bts = bts[frameLengthSize:]
+		if len(bts) < n {
+			t.Fatalf("truncated frame: %q", bts)
+		}
+		frames = append(frames, string(bts[:n]))
+		bts = bts[n:]
+	}
+	return frames
+}
+
+func TestFraming(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "info.log")
+	var b strings.Builder
+	for _, output := range []interface{}{path, &b} {
+		hook, err := NewLfsHookWithOptions(output, WithRawMode(), WithFraming(FramingLengthPrefix))
+		if err != nil {
+			t.Fatal(err)
+		}
+		logger := logrus.New()
+		logger.Out = ioutil.Discard
+		logger.AddHook(hook)
+		logger.Info("one")
+		logger.Info("two\nlines")
+		hook.Close()
+		if n := hook.Stats().BytesWritten; n != 2*frameLengthSize+uint64(len("one\ntwo\nlines\n")) {
+			t.Fatalf("the prefixes should be counted, got %d bytes", n)
+		}
+	}
+
+	bts, _ := ioutil.ReadFile(path)
+	for _, frames := range [][]string{readFrames(t, bts), readFrames(t, []byte(b.String()))} {
+		if len(frames) != 2 || frames[0] != "one\n" || frames[1] != "two\nlines\n" {
+			t.Fatalf("unexpected frames: %q", frames)
+		}
+	}
+
+	// the header is a frame too
+	path = filepath.Join(t.TempDir(), "header.log")
+	hook, err := NewLfsHookWithOptions(path, WithRawMode(), WithFraming(FramingLengthPrefix), WithFileHeader(func() []byte {
+		return []byte("# header\n")
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hook.Fire(&logrus.Entry{Logger: logrus.New(), Level: logrus.InfoLevel, Message: "one"})
+	hook.Close()
+	bts, _ = ioutil.ReadFile(path)
+	if frames := readFrames(t, bts); len(frames) != 2 || frames[0] != "# header\n" || frames[1] != "one\n" {
+		t.Fatalf("unexpected frames: %q", frames)
+	}
+}
+
+func TestMkdirRetry(t *testing.T) {
+	dir := t.TempDir()
+	blocker := filepath.Join(dir, "logs")
+	if err := ioutil.WriteFile(blocker, nil, 0664); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(blocker, "info.log")
+	hook := NewLfsHook(path, nil)
+	var errs []error
+	hook.OnError = func(err error, entry *logrus.Entry) {
+		errs = append(errs, err)
+	}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	logger.Info("this is lost")
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "failed to create the directory") {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	// the directory can be created once the file in the way is removed
+	if err := os.Remove(blocker); err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("this is info")
+	hook.Close()
+	if len(errs) != 1 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if bts, _ := ioutil.ReadFile(path); !strings.Contains(string(bts), "this is info") {
+		t.Fatalf("unexpected content: %s", bts)
+	}
+}
+
+// flakyWriter fails the first writes with err.
+type flakyWriter struct {
+	strings.Builder
+	fails int
+	err   error
+	calls int
+}
+
+func (w *flakyWriter) Write(p []byte) (int, error) {
+	w.calls++
+	if w.fails > 0 {
+		w.fails--
+		return 0, w.err
+	}
+	return w.Builder.Write(p)
+}
+
+func TestWriteRetries(t *testing.T) {
+	w := &flakyWriter{fails: 2, err: syscall.EAGAIN}
+	hook, err := NewLfsHookWithOptions(w, WithRawMode(), WithWriteRetries(3, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	logger.Info("this is info")
+	if w.String() != "this is info\n" || hook.Stats().Retries != 2 {
+		t.Fatalf("unexpected output %q with %d retries", w.String(), hook.Stats().Retries)
+	}
+
+	// not transient
+	w.fails, w.err, w.calls = 2, syscall.EBADF, 0
+	hook.Fire(logrus.NewEntry(logger))
+	if w.calls != 1 || hook.Stats().Retries != 2 {
+		t.Fatalf("the error should fail at once, %d calls", w.calls)
+	}
+
+	// the backoff is cut short by the context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	hook.SetContext(ctx)
+	w.fails, w.err, w.calls = 2, syscall.EIO, 0
+	hook.RetryBackoff = time.Hour
+	hook.fire(nil, logrus.NewEntry(logger))
+	if w.calls != 1 {
+		t.Fatalf("the retry should stop with the context, %d calls", w.calls)
+	}
+}
+
+// shortWriter writes at most max bytes per call without an error.
+type shortWriter struct {
+	strings.Builder
+	max   int
+	calls int
+}
+
+func (w *shortWriter) Write(p []byte) (int, error) {
+	w.calls++
+	if len(p) > w.max {
+		p = p[:w.max]
+	}
+	return w.Builder.Write(p)
+}
+
+func TestShortWrite(t *testing.T) {
+	w := &shortWriter{max: 5}
+	hook, err := NewLfsHookWithOptions(w, WithRawMode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	entry := logrus.NewEntry(logger)
+	entry.Level = logrus.InfoLevel
+	entry.Message = "this is info"
+
+	// the remainder is written once more, then it gives up
+	if err := hook.Fire(entry); err != io.ErrShortWrite {
+		t.Fatalf("expected the short write error, got %v", err)
+	}
+	if w.String() != "this is in" || w.calls != 2 {
+		t.Fatalf("unexpected output %q with %d calls", w.String(), w.calls)
+	}
+
+	// the short write is transient, the retries finish the entry
+	w.Reset()
+	w.calls = 0
+	hook.WriteRetries = 3
+	if err := hook.Fire(entry); err != nil {
+		t.Fatal(err)
+	}
+	if w.String() != "this is info\n" || w.calls != 3 || hook.Stats().Retries != 1 {
+		t.Fatalf("unexpected output %q with %d calls and %d retries", w.String(), w.calls, hook.Stats().Retries)
+	}
+}
+
+func TestLevelLimits(t *testing.T) {
+	dir := t.TempDir()
+	info, errs := filepath.Join(dir, "info.log"), filepath.Join(dir, "error.log")
+	hook, err := NewLfsHookWithOptions(PathMap{logrus.InfoLevel: info, logrus.ErrorLevel: errs},
+		WithRawMode(), WithMaxSize(1024), WithMaxBackups(5), WithLevelLimits(logrus.ErrorLevel, 10, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	for i := 0; i < 5; i++ {
+		logger.Info("this is info")
+		logger.Error("this is error")
+	}
+	hook.Close()
+
+	for name, exists := range map[string]bool{
+		info + ".1": false,
+		errs + ".1": true,
+		errs + ".2": true,
+		errs + ".3": false,
+	} {
+		if _, err := os.Stat(name); os.IsNotExist(err) == exists {
+			t.Fatalf("%s should exist: %v", name, exists)
+		}
+	}
+}
+
+func TestWriterFor(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "info.log")
+	hook := NewLfsHook(PathMap{logrus.InfoLevel: path}, nil, 20, 5)
+	w := hook.WriterFor(logrus.InfoLevel)
+	std := log.New(w, "", 0)
+	std.Print("this is std log")
+	std.Print("this is std log")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("closed\n")); err == nil {
+		t.Fatal("the closed writer should fail")
+	}
+	if _, err := hook.WriterFor(logrus.WarnLevel).Write([]byte("warn\n")); err == nil {
+		t.Fatal("the level without file should fail")
+	}
+	hook.Close()
+
+	for _, name := range []string{path, path + ".1"} {
+		if bts, _ := ioutil.ReadFile(name); string(bts) != "this is std log\n" {
+			t.Fatalf("unexpected content of %s: %q", name, bts)
+		}
+	}
+}
+
+func TestWriterForPause(t *testing.T) {
+	dir := t.TempDir()
+	info, debug := filepath.Join(dir, "info.log"), filepath.Join(dir, "debug.log")
+	hook := NewLfsHook(PathMap{logrus.InfoLevel: info, logrus.DebugLevel: debug}, nil)
+	hook.SetLevels([]logrus.Level{logrus.InfoLevel})
+	defer hook.Close()
+
+	// left out by SetLevels
+	if _, err := hook.WriterFor(logrus.DebugLevel).Write([]byte("debug\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(debug); !os.IsNotExist(err) {
+		t.Fatal("the level left out should not be written")
+	}
+
+	w := hook.WriterFor(logrus.InfoLevel)
+	if _, err := w.Write([]byte("before pause\n")); err != nil {
+		t.Fatal(err)
+	}
+	hook.Pause()
+	if err := os.Rename(info, info+".old"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("while paused\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(info); !os.IsNotExist(err) {
+		t.Fatal("the file should not be written while paused")
+	}
+	hook.Resume()
+	if _, err := w.Write([]byte("after resume\n")); err != nil {
+		t.Fatal(err)
+	}
+	if bts, _ := ioutil.ReadFile(info); string(bts) != "after resume\n" {
+		t.Fatalf("unexpected content: %q", bts)
+	}
+	if st := hook.Stats(); st.DroppedEntries != 1 {
+		t.Fatalf("unexpected dropped entries: %d", st.DroppedEntries)
+	}
+}
+
+func TestSizeMap(t *testing.T) {
+	dir := t.TempDir()
+	debug, errs := filepath.Join(dir, "debug.log"), filepath.Join(dir, "error.log")
+	hook, err := NewLfsHookWithOptions(PathMap{logrus.DebugLevel: debug, logrus.ErrorLevel: errs}, WithRawMode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hook.SizeMap = map[logrus.Level]int64{logrus.DebugLevel: 10, logrus.ErrorLevel: 30}
+	hook.LenMap = map[logrus.Level]int{logrus.DebugLevel: 2}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.SetLevel(logrus.DebugLevel)
+	logger.AddHook(hook)
+	for i := 0; i < 4; i++ {
+		logger.Debug("debug")
+		logger.Error("error")
+	}
+
+	for name, exists := range map[string]bool{
+		debug + ".1": true,
+		debug + ".2": true,
+		debug + ".3": false,
+		errs + ".1":  false,
+	} {
+		if _, err := os.Stat(name); os.IsNotExist(err) == exists {
+			t.Fatalf("%s should exist: %v", name, exists)
+		}
+	}
+
+	// the limits changed at runtime take effect on the next write
+	hook.SetLevelLimits(logrus.ErrorLevel, 10, 0)
+	logger.Error("error")
+	hook.Close()
+	if _, err := os.Stat(errs + ".1"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWarnUnmatched(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "info.log")
+	hook := NewLfsHook(PathMap{logrus.InfoLevel: path}, nil)
+	hook.SetLevels([]logrus.Level{logrus.InfoLevel, logrus.WarnLevel})
+	var errs []error
+	hook.OnError = func(err error, entry *logrus.Entry) {
+		errs = append(errs, err)
+	}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	logger.Info("this is info")
+	logger.Warn("this is warn")
+	logger.Warn("this is warn")
+	hook.Close()
+
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "no output for level warning") {
+		t.Fatalf("expected one warning, got %v", errs)
+	}
+
+	// the unmapped levels of a PathMap aren't fired, Validate reports them
+	hook = NewLfsHook(PathMap{logrus.InfoLevel: path, logrus.ErrorLevel: path}, nil)
+	errs = nil
+	hook.OnError = func(err error, entry *logrus.Entry) {
+		errs = append(errs, err)
+	}
+	if err := hook.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	hook.Validate()
+	if len(errs) != 5 {
+		t.Fatalf("expected the warnings of 5 levels, got %v", errs)
+	}
+	for _, err := range errs {
+		if strings.Contains(err.Error(), "level info") || strings.Contains(err.Error(), "level error") {
+			t.Fatalf("unexpected warning: %v", err)
+		}
+	}
+}
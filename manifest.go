@@ -0,0 +1,101 @@
+package loglfshook
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// manifestSuffix is appended to the log file's path to name its manifest.
+const manifestSuffix = ".manifest.jsonl"
+
+// The rotation reasons recorded in the manifest.
+const (
+	rotateSize   = "size"
+	rotateTime   = "time"
+	rotateLines  = "lines"
+	rotateDaily  = "daily"
+	rotateManual = "manual"
+	rotateCustom = "custom"
+)
+
+// ManifestRecord is a line of the manifest written for each rotation when LfsHook.Manifest is set.
+type ManifestRecord struct {
+	// File is the path of the rotated file, ending with ".gz" if the backup is compressed by Compress.
+	// The record is written once the compression is done, the path is kept if the compression failed.
+	// The backups aren't compressed again with CompressActive, their path is kept.
+	File string `json:"file"`
+	// Size is the size of the rotated file.
+	Size int64 `json:"size"`
+	// First and Last are the times of the first and last entries written to the file by the hook,
+	// they are zero if the file was written by another process.
+	First time.Time `json:"first"`
+	Last  time.Time `json:"last"`
+	// Reason is what triggered the rotation: size, lines, time, daily, manual or custom.
+	Reason string `json:"reason"`
+}
+
+// fileManifest appends the rotation record to the manifest of the file.
+// If the backup is compressed in background, the record is written once the compression is done
+// with the name of the file that exists, after the records of the previous rotations.
+func (c *LfsHook) fileManifest(fe *lfsFile, name, reason string) {
+	if !c.Manifest {
+		return
+	}
+	rc := ManifestRecord{
+		File:   name,
+		Size:   fe.ln,
+		First:  fe.firstAt,
+		Last:   fe.lastAt,
+		Reason: reason,
+	}
+	path := fe.path + manifestSuffix
+	if !c.Compress || c.CompressActive {
+		if err := c.manifestWrite(path, rc); err != nil {
+			c.fileError(fe, err, "failed to write manifest:")
+		}
+		return
+	}
+
+	c.mlk.Lock()
+	prev := c.mlast
+	done := make(chan struct{})
+	c.mlast = done
+	c.mlk.Unlock()
+	c.zwg.Add(1)
+	go func() {
+		if prev != nil {
+			<-prev
+		}
+		// the compression holds zlk until it's done
+		c.zlk.Lock()
+		if _, err := os.Stat(name); os.IsNotExist(err) {
+			rc.File += compressSuffix
+		}
+		c.zlk.Unlock()
+		err := c.manifestWrite(path, rc)
+		close(done)
+		// Close waits for zwg under hook.lock, the callback may log
+		c.zwg.Done()
+		if err != nil {
+			c.handleError(err, nil, "failed to write manifest:")
+		}
+	}()
+}
+
+// manifestWrite appends the record to the manifest at path.
+func (c *LfsHook) manifestWrite(path string, rc ManifestRecord) error {
+	bts, err := json.Marshal(rc)
+	if err != nil {
+		return err
+	}
+	c.mlk.Lock()
+	defer c.mlk.Unlock()
+	fl, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, c.FileMode)
+	if err != nil {
+		return err
+	}
+	defer fl.Close()
+	_, err = fl.Write(append(bts, '\n'))
+	return err
+}
@@ -0,0 +1,62 @@
+package loglfshook
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// lockSuffix is appended to the path of a log file to name its lock file for MultiProcess.
+const lockSuffix = ".lock"
+
+// fileLock takes the advisory lock of the file for MultiProcess, the caller must hold fe.lk.
+// The lock is taken on a separate lock file, since the log file itself is renamed by the rotations.
+// It returns the func releasing the lock, the writes go on unlocked if the lock file can't be opened.
+func (c *LfsHook) fileLock(fe *lfsFile) func() {
+	if !c.MultiProcess || !flockSupported {
+		return func() {}
+	}
+	path := expandPath(fe.tmpl, c.now()) + lockSuffix
+	if fe.lkf != nil && fe.lkf.Name() != path {
+		fe.release()
+	}
+	if fe.lkf == nil {
+		os.MkdirAll(filepath.Dir(path), c.DirMode)
+		fl, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, c.FileMode)
+		if err != nil {
+			c.fileError(fe, err, "failed to open lock file:")
+			return func() {}
+		}
+		fe.lkf = fl
+	}
+	fl := fe.lkf
+	if err := flock(fl); err != nil {
+		c.fileError(fe, err, "failed to lock log file:")
+		return func() {}
+	}
+	return func() {
+		funlock(fl)
+	}
+}
+
+// fileSynced reloads the state of the opened file changed by the other processes, the caller must hold
+// fe.lk and the advisory lock. The file is reopened if another process rotated it.
+func (c *LfsHook) fileSynced(fe *lfsFile) {
+	if fe.fd == nil {
+		return
+	}
+	if c.fileChanged(fe) {
+		fe.close()
+		return
+	}
+	if stat, err := fe.fd.Stat(); err == nil {
+		fe.ln = stat.Size()
+	}
+}
+
+// release closes the lock file of MultiProcess, the caller must hold fe.lk.
+func (fe *lfsFile) release() {
+	if fe.lkf != nil {
+		fe.lkf.Close()
+		fe.lkf = nil
+	}
+}
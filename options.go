@@ -0,0 +1,329 @@
+package loglfshook
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"time"
+)
+
+// Option configures the LfsHook created by NewLfsHookWithOptions.
+type Option func(hook *LfsHook)
+
+// WithFormatter sets the formatter, see LfsHook.SetFormatter.
+func WithFormatter(formatter logrus.Formatter) Option {
+	return func(hook *LfsHook) {
+		hook.SetFormatter(formatter)
+	}
+}
+
+// WithFormatterMap sets the formatters of the levels, see LfsHook.SetLevelFormatter.
+func WithFormatterMap(formatters FormatterMap) Option {
+	return func(hook *LfsHook) {
+		for level, formatter := range formatters {
+			hook.SetLevelFormatter(level, formatter)
+		}
+	}
+}
+
+// WithMaxSize sets the max size of a log file before it is rotated.
+func WithMaxSize(size int64) Option {
+	return func(hook *LfsHook) {
+		hook.FdMaxSize = size
+	}
+}
+
+// WithMaxLines sets the max line count of the log files, see LfsHook.MaxLines.
+func WithMaxLines(lines int64) Option {
+	return func(hook *LfsHook) {
+		hook.MaxLines = lines
+	}
+}
+
+// WithMaxBackups sets the max count of the rotated files.
+func WithMaxBackups(count int) Option {
+	return func(hook *LfsHook) {
+		hook.FdMaxLen = count
+	}
+}
+
+// WithMaxAge removes the rotated files older than the given duration.
+func WithMaxAge(age time.Duration) Option {
+	return func(hook *LfsHook) {
+		hook.MaxAge = age
+	}
+}
+
+// WithBackupName names the rotated files by the function, see LfsHook.BackupNameFunc.
+func WithBackupName(name func(path string, t time.Time) string, useLocalTime bool) Option {
+	return func(hook *LfsHook) {
+		hook.BackupNameFunc = name
+		hook.UseLocalTime = useLocalTime
+	}
+}
+
+// WithMaxTotalSize sets the max total size of the backups of a log file, see LfsHook.MaxTotalSize.
+func WithMaxTotalSize(size int64) Option {
+	return func(hook *LfsHook) {
+		hook.MaxTotalSize = size
+	}
+}
+
+// WithMinRotateInterval rotates a file once per interval at most, see LfsHook.MinRotateInterval.
+func WithMinRotateInterval(interval time.Duration) Option {
+	return func(hook *LfsHook) {
+		hook.MinRotateInterval = interval
+	}
+}
+
+// WithCompress gzips the rotated files.
+func WithCompress(compress bool) Option {
+	return func(hook *LfsHook) {
+		hook.Compress = compress
+	}
+}
+
+// WithFileMode sets the permission used to create the log files.
+func WithFileMode(mode os.FileMode) Option {
+	return func(hook *LfsHook) {
+		hook.FileMode = mode
+	}
+}
+
+// WithDirMode sets the permission used to create the log directories.
+func WithDirMode(mode os.FileMode) Option {
+	return func(hook *LfsHook) {
+		hook.DirMode = mode
+	}
+}
+
+// WithQueue enables the asynchronous mode with the queue size and the policy used when the queue is full.
+func WithQueue(size int, policy QueuePolicy) Option {
+	return func(hook *LfsHook) {
+		hook.QueueSize = size
+		hook.QueuePolicy = policy
+	}
+}
+
+// WithBuffer enables buffered writes with the buffer size, flushed when full and every interval.
+func WithBuffer(size int, interval time.Duration) Option {
+	return func(hook *LfsHook) {
+		hook.BufferSize = size
+		hook.FlushInterval = interval
+	}
+}
+
+// WithReopenOnChange reopens the log files moved or removed externally, checked once per interval at most.
+// A zero interval checks once per second.
+func WithReopenOnChange(interval time.Duration) Option {
+	return func(hook *LfsHook) {
+		hook.ReopenOnChange = true
+		hook.ReopenCheckInterval = interval
+	}
+}
+
+// WithCombined writes the entries of all levels to the path too, see LfsHook.SetCombinedPath.
+func WithCombined(path string) Option {
+	return func(hook *LfsHook) {
+		hook.combinedPath = path
+	}
+}
+
+// WithThreshold makes the level receive the more severe levels too, see LfsHook.SetThreshold.
+func WithThreshold() Option {
+	return func(hook *LfsHook) {
+		hook.threshold = true
+	}
+}
+
+// WithSyslog writes the entries to the syslog writer too, see LfsHook.SetSyslog.
+func WithSyslog(writer SyslogWriter) Option {
+	return func(hook *LfsHook) {
+		hook.syslog = writer
+	}
+}
+
+// WithSyncInterval fsyncs the opened files every interval, see LfsHook.SyncInterval.
+func WithSyncInterval(interval time.Duration) Option {
+	return func(hook *LfsHook) {
+		hook.SyncInterval = interval
+	}
+}
+
+// WithSyncOnWrite fsyncs the file after each write, see LfsHook.SyncOnWrite.
+func WithSyncOnWrite() Option {
+	return func(hook *LfsHook) {
+		hook.SyncOnWrite = true
+	}
+}
+
+// WithRotateUpload uploads the rotated files in background, see LfsHook.OnRotateUpload.
+func WithRotateUpload(upload func(path string) error) Option {
+	return func(hook *LfsHook) {
+		hook.OnRotateUpload = upload
+	}
+}
+
+// WithSizeCheck reads the file's size from the disk every count of writes, see LfsHook.SizeCheckWrites.
+func WithSizeCheck(writes int) Option {
+	return func(hook *LfsHook) {
+		hook.SizeCheckWrites = writes
+	}
+}
+
+// WithFallbackWriter writes the entries failed to be written to their files to the writer, see LfsHook.FallbackWriter.
+func WithFallbackWriter(writer io.Writer) Option {
+	return func(hook *LfsHook) {
+		hook.FallbackWriter = writer
+	}
+}
+
+// WithRawMode writes the messages without formatting, see LfsHook.RawMode.
+func WithRawMode() Option {
+	return func(hook *LfsHook) {
+		hook.RawMode = true
+	}
+}
+
+// WithSample writes n entries per interval at most for each level, see LfsHook.Sample.
+func WithSample(n int, per time.Duration) Option {
+	return func(hook *LfsHook) {
+		hook.sampler = newSampler(n, per)
+	}
+}
+
+// WithSampling writes 1 of every n entries of the level, see LfsHook.SetSampling.
+func WithSampling(level logrus.Level, n int) Option {
+	return func(hook *LfsHook) {
+		hook.SetSampling(level, n)
+	}
+}
+
+// WithWriteRetries retries the transient write errors, see LfsHook.WriteRetries.
+func WithWriteRetries(retries int, backoff time.Duration) Option {
+	return func(hook *LfsHook) {
+		hook.WriteRetries = retries
+		hook.RetryBackoff = backoff
+	}
+}
+
+// WithLevelLimits overrides the max size and backups of the level, see LfsHook.SetLevelLimits.
+func WithLevelLimits(level logrus.Level, maxSize int64, maxBackups int) Option {
+	return func(hook *LfsHook) {
+		hook.SetLevelLimits(level, maxSize, maxBackups)
+	}
+}
+
+// WithFraming sets how the entries are delimited, see LfsHook.Framing.
+func WithFraming(framing Framing) Option {
+	return func(hook *LfsHook) {
+		hook.Framing = framing
+	}
+}
+
+// WithDedupeConsecutive collapses the consecutive duplicates, see LfsHook.DedupeConsecutive.
+func WithDedupeConsecutive() Option {
+	return func(hook *LfsHook) {
+		hook.DedupeConsecutive = true
+	}
+}
+
+// WithOwnWriters closes the writers implementing io.Closer on Close, see LfsHook.CloseWriters.
+func WithOwnWriters() Option {
+	return func(hook *LfsHook) {
+		hook.CloseWriters = true
+	}
+}
+
+// WithDefaultFields adds the fields to every entry written by the hook, see LfsHook.SetDefaultFields.
+func WithDefaultFields(fields logrus.Fields) Option {
+	return func(hook *LfsHook) {
+		hook.fields = copyFields(fields)
+	}
+}
+
+// WithMaxLineBytes truncates the long entries, see LfsHook.MaxLineBytes.
+func WithMaxLineBytes(max int) Option {
+	return func(hook *LfsHook) {
+		hook.MaxLineBytes = max
+	}
+}
+
+// WithEnsureNewline appends a newline to the entries not ending with one.
+func WithEnsureNewline() Option {
+	return func(hook *LfsHook) {
+		hook.EnsureNewline = true
+	}
+}
+
+// WithFileHeader sets the header of the new files, see LfsHook.FileHeader.
+func WithFileHeader(header func() []byte) Option {
+	return func(hook *LfsHook) {
+		hook.FileHeader = header
+	}
+}
+
+// WithCompressActive gzips the active log files, see LfsHook.CompressActive.
+func WithCompressActive() Option {
+	return func(hook *LfsHook) {
+		hook.CompressActive = true
+	}
+}
+
+// WithRotateMode sets how the files are rotated, see LfsHook.RotateMode.
+func WithRotateMode(mode RotateMode) Option {
+	return func(hook *LfsHook) {
+		hook.RotateMode = mode
+	}
+}
+
+// WithTruncate empties the log files first opened by the hook, see LfsHook.Truncate.
+func WithTruncate() Option {
+	return func(hook *LfsHook) {
+		hook.Truncate = true
+	}
+}
+
+// WithOpenFlags sets the flags opening the log files, see LfsHook.OpenFlags.
+func WithOpenFlags(flags int) Option {
+	return func(hook *LfsHook) {
+		hook.OpenFlags = flags
+	}
+}
+
+// WithMultiProcess locks the files written by several processes, see LfsHook.MultiProcess.
+func WithMultiProcess() Option {
+	return func(hook *LfsHook) {
+		hook.MultiProcess = true
+	}
+}
+
+// WithRotator sets the rotator deciding when and how the log files are rotated.
+func WithRotator(rotator Rotator) Option {
+	return func(hook *LfsHook) {
+		hook.Rotator = rotator
+	}
+}
+
+// WithFieldRoute writes the entries to the files routed by the field's value, see SetFieldRoute.
+func WithFieldRoute(field string, route func(value string) string) Option {
+	return func(hook *LfsHook) {
+		hook.routeField = field
+		hook.routeFunc = route
+	}
+}
+
+// WithContext ties the hook to the context, see SetContext.
+func WithContext(ctx context.Context) Option {
+	return func(hook *LfsHook) {
+		hook.ctx = ctx
+	}
+}
+
+// WithBackupIndexName names the numbered backups by the function, see LfsHook.BackupIndexName.
+func WithBackupIndexName(name func(path string, index int) string) Option {
+	return func(hook *LfsHook) {
+		hook.BackupIndexName = name
+	}
+}
@@ -0,0 +1,55 @@
+package loglfshook
+
+import (
+	"github.com/sirupsen/logrus"
+	"sync/atomic"
+)
+
+// Pause suspends the output without tearing down the hook, e.g. while an external tool compacts the directory.
+// The buffered writes are flushed and the opened files are closed, Fire returns nil without writing until Resume.
+// Up to PauseBuffer entries are kept meanwhile and written on Resume, the others are dropped.
+// The entries queued by QueueSize before Pause are written before the files are closed.
+func (hook *LfsHook) Pause() error {
+	atomic.StoreInt32(&hook.paused, 1)
+	hook.stopQueue()
+	return hook.Reopen()
+}
+
+// Resume restarts the output suspended by Pause and writes the kept entries.
+// It returns the first error of writing the kept entries.
+func (hook *LfsHook) Resume() error {
+	hook.plk.Lock()
+	atomic.StoreInt32(&hook.paused, 0)
+	kept := hook.kept
+	hook.kept = nil
+	hook.plk.Unlock()
+
+	var err error
+	for _, entry := range kept {
+		// the kept entries are already sampled
+		if e := hook.fireSampled(nil, entry); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// pauseKeep keeps a copy of the entry fired while paused, it reports false if the hook isn't paused.
+func (hook *LfsHook) pauseKeep(entry *logrus.Entry) bool {
+	if atomic.LoadInt32(&hook.paused) == 0 {
+		return false
+	}
+	hook.plk.Lock()
+	defer hook.plk.Unlock()
+	if atomic.LoadInt32(&hook.paused) == 0 {
+		// resumed meanwhile
+		return false
+	}
+	if len(hook.kept) >= hook.PauseBuffer {
+		atomic.AddUint64(&hook.stats.dropped, 1)
+		return true
+	}
+	// logrus reuses the entry after the hooks, so the entry and its fields are copied
+	hook.kept = append(hook.kept, copyEntry(entry))
+	return true
+}
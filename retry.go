@@ -0,0 +1,73 @@
+package loglfshook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// ctxBox holds the hook's context in an atomic.Value, which needs a consistent type.
+type ctxBox struct {
+	ctx context.Context
+}
+
+// retryable reports whether the write error is transient, e.g. on the network filesystems.
+func retryable(err error) bool {
+	return errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EINTR) || errors.Is(err, syscall.EIO) ||
+		err == io.ErrShortWrite
+}
+
+// writeRetry writes the msg to w, the remainder of a short write is written once more. The transient errors are
+// retried up to retries times, waiting RetryBackoff doubled after each retry, the other errors fail at once.
+func (hook *LfsHook) writeRetry(w io.Writer, msg []byte, retries int) (int, error) {
+	n, err := w.Write(msg)
+	if n > 0 && n < len(msg) {
+		// short write, try the remainder once more before giving up
+		var m int
+		m, err = w.Write(msg[n:])
+		n += m
+		if err == nil && n < len(msg) {
+			err = io.ErrShortWrite
+		}
+	}
+	for i := 0; err != nil && i < retries && retryable(err); i++ {
+		if !hook.retryWait(hook.RetryBackoff << uint(i)) {
+			break
+		}
+		atomic.AddUint64(&hook.stats.retries, 1)
+		var m int
+		m, err = w.Write(msg[n:])
+		n += m
+		if err == nil && n < len(msg) {
+			err = io.ErrShortWrite
+		}
+	}
+	return n, err
+}
+
+// retryWait waits d before a retry, it reports false if the hook's context is done meanwhile.
+func (hook *LfsHook) retryWait(d time.Duration) bool {
+	var done <-chan struct{}
+	if box, ok := hook.ctxv.Load().(ctxBox); ok {
+		done = box.ctx.Done()
+	}
+	if d <= 0 {
+		select {
+		case <-done:
+			return false
+		default:
+			return true
+		}
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-done:
+		return false
+	}
+}
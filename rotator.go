@@ -0,0 +1,144 @@
+package loglfshook
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// RotateMode decides how the active file is moved to the backup on rotation.
+type RotateMode int
+
+const (
+	// RotateRename renames the active file to the backup and opens a new file at the path.
+	RotateRename RotateMode = iota
+	// RotateCopyTruncate copies the active file to the backup and truncates it in place, so the file
+	// keeps its inode for the tools holding it open. The entries written by other processes between
+	// the copy and the truncation are lost.
+	RotateCopyTruncate
+)
+
+// RotateState is the state of an active log file passed to the Rotator.
+type RotateState struct {
+	// Path is the path of the active log file.
+	Path string
+	// Size is the current size of the file, including the header.
+	Size int64
+	// HeaderSize is the size of the header written by LfsHook.FileHeader.
+	HeaderSize int64
+	// Lines is the count of the lines written since the file was opened, excluding the header.
+	Lines int64
+	// OpenedAt is the time the file was opened.
+	OpenedAt time.Time
+}
+
+// Rotator decides when and how the log files are rotated.
+type Rotator interface {
+	// ShouldRotate reports whether the file should be rotated before writing size bytes.
+	ShouldRotate(st RotateState, size int64) bool
+	// Rotate moves the file at path away and returns the new path, the hook reopens the path afterward.
+	Rotate(path string) (string, error)
+}
+
+// defaultRotator rotates by FdMaxSize, MaxLines and RotationInterval into the numbered backups.
+type defaultRotator struct {
+	hook *LfsHook
+	// limits are the limits of the file's level, the hook's limits are used if not leveled
+	limits  lfsLimits
+	leveled bool
+}
+
+// DefaultRotator returns the built-in rotator of the hook, which is used if LfsHook.Rotator is nil.
+// It rotates by FdMaxSize, MaxLines and RotationInterval, keeps FdMaxLen numbered backups
+// and applies Compress and MaxAge. It can be wrapped by a custom Rotator.
+func (hook *LfsHook) DefaultRotator() Rotator {
+	return &defaultRotator{hook: hook}
+}
+
+// fileRotator returns the Rotator of the file, the built-in rotator applies the limits of the file's level.
+// The caller must hold fe.lk.
+func (c *LfsHook) fileRotator(fe *lfsFile) Rotator {
+	if c.Rotator != nil {
+		return c.Rotator
+	}
+	return &defaultRotator{hook: c, limits: c.fileLimits(fe), leveled: true}
+}
+func (r *defaultRotator) maxSize() int64 {
+	if r.leveled {
+		return r.limits.size
+	}
+	return r.hook.maxSize()
+}
+func (r *defaultRotator) maxBackups() int {
+	if r.leveled {
+		return r.limits.backups
+	}
+	return r.hook.maxBackups()
+}
+
+func (r *defaultRotator) ShouldRotate(st RotateState, size int64) bool {
+	c := r.hook
+	if st.Size <= st.HeaderSize {
+		return false
+	}
+	if overSize(st.Size, size, r.maxSize()) {
+		return true
+	}
+	if c.MaxLines > 0 && st.Lines >= c.MaxLines {
+		return true
+	}
+	return c.RotationInterval > 0 && c.since(st.OpenedAt) >= c.RotationInterval
+}
+
+func (r *defaultRotator) Rotate(path string) (string, error) {
+	c := r.hook
+	// wait for the pending compression before moving the backups
+	c.zlk.Lock()
+	if c.MaxAge > 0 {
+		c.fileDayClean(path)
+	}
+	var name string
+	if c.BackupNameFunc != nil {
+		name = c.fileBakTimed(path, r.maxBackups())
+	} else {
+		name = c.fileBakShift(path, r.maxBackups())
+	}
+	if err := c.fileMove(path, name); err != nil {
+		c.zlk.Unlock()
+		return "", err
+	}
+	c.fileCompress(name)
+	return name, nil
+}
+
+// fileMove moves the active file at path to the backup name by the RotateMode.
+func (c *LfsHook) fileMove(path, name string) error {
+	if c.RotateMode != RotateCopyTruncate {
+		return os.Rename(path, name)
+	}
+	if err := copyFile(path, name, c.FileMode); err != nil {
+		return err
+	}
+	return os.Truncate(path, 0)
+}
+
+// copyFile copies the file at src to the new file dst, dst is removed if the copy fails.
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if e := out.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(dst)
+	}
+	return err
+}
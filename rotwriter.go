@@ -0,0 +1,62 @@
+package loglfshook
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"sync/atomic"
+	"time"
+)
+
+// RotatingWriter is a writer rotated by the hook like the log files, by FdMaxSize, MaxLines and RotationInterval
+// or the ShouldRotate of LfsHook.Rotator, e.g. a network sink starting a new remote object on each rotation.
+type RotatingWriter interface {
+	io.Writer
+	// Rotate starts a new segment of the output, it's called before the write exceeding the limits.
+	Rotate() error
+}
+
+// lfsWriterState is the state of a RotatingWriter since it's rotated.
+type lfsWriterState struct {
+	size     int64
+	lines    int64
+	openedAt time.Time
+}
+
+// writerRotate rotates the writer before writing size bytes if needed and returns its state,
+// the state is nil if the writer isn't a comparable RotatingWriter. The caller must hold hook.lock.
+func (hook *LfsHook) writerRotate(writer io.Writer, size int64) (*lfsWriterState, error) {
+	rw, ok := writer.(RotatingWriter)
+	if !ok || !reflect.TypeOf(rw).Comparable() {
+		return nil, nil
+	}
+	st, ok := hook.wstates[rw]
+	if !ok {
+		if hook.wstates == nil {
+			hook.wstates = make(map[RotatingWriter]*lfsWriterState)
+		}
+		st = &lfsWriterState{openedAt: hook.now()}
+		hook.wstates[rw] = st
+	}
+	rotator := hook.Rotator
+	if rotator == nil {
+		rotator = hook.DefaultRotator()
+	}
+	if !rotator.ShouldRotate(RotateState{Size: st.size, Lines: st.lines, OpenedAt: st.openedAt}, size) {
+		return st, nil
+	}
+	if err := rw.Rotate(); err != nil {
+		return st, err
+	}
+	atomic.AddUint64(&hook.stats.rotations, 1)
+	*st = lfsWriterState{openedAt: hook.now()}
+	return st, nil
+}
+
+// written counts the bytes written to the writer.
+func (st *lfsWriterState) written(msg []byte) {
+	if st != nil {
+		st.size += int64(len(msg))
+		st.lines += int64(bytes.Count(msg, []byte{'\n'}))
+	}
+}
@@ -0,0 +1,85 @@
+package loglfshook
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+)
+
+// SetFieldRoute writes the entries having the field to the path returned by the route for the field's value,
+// e.g. per-tenant files. The entries without the field, or routed to an empty path, are written by their level.
+// Each distinct path has its own file, up to MaxRouteFiles are kept opened.
+func (hook *LfsHook) SetFieldRoute(field string, route func(value string) string) {
+	hook.lock.Lock()
+	defer hook.lock.Unlock()
+	hook.routeField = field
+	hook.routeFunc = route
+}
+
+// routePath returns the routed path of the entry, the caller must hold hook.lock.
+func (hook *LfsHook) routePath(entry *logrus.Entry) (string, bool) {
+	if hook.routeField == "" || hook.routeFunc == nil {
+		return "", false
+	}
+	value, ok := entry.Data[hook.routeField]
+	if !ok {
+		return "", false
+	}
+	path := hook.routeFunc(fmt.Sprint(value))
+	return path, path != ""
+}
+
+// routeGet returns the routed file of the path, the least recently used file is closed
+// if there are too many opened files.
+func (hook *LfsHook) routeGet(level logrus.Level, path string) *lfsFile {
+	hook.flk.Lock()
+	defer hook.flk.Unlock()
+	if fe, ok := hook.fls[path]; ok {
+		// the path of a level, share its file
+		return fe
+	}
+	fe, ok := hook.routes[path]
+	if !ok {
+		if hook.routes == nil {
+			hook.routes = make(map[string]*lfsFile)
+		}
+		var errs []lfsError
+		for hook.MaxRouteFiles > 0 && len(hook.routes) >= hook.MaxRouteFiles {
+			errs = append(errs, hook.routeEvict()...)
+		}
+		fe = &lfsFile{
+			tmpl:   path,
+			level:  level,
+			routed: true,
+			// reported with the first write of the new file
+			errs: errs,
+		}
+		hook.routes[path] = fe
+	}
+	fe.usedAt = hook.now()
+	return fe
+}
+
+// routeEvict closes the least recently used routed file and returns the errors closing it,
+// the caller must hold hook.flk.
+func (hook *LfsHook) routeEvict() []lfsError {
+	var lru *lfsFile
+	for _, fe := range hook.routes {
+		if lru == nil || fe.usedAt.Before(lru.usedAt) {
+			lru = fe
+		}
+	}
+	lru.lk.Lock()
+	defer lru.lk.Unlock()
+	if err := hook.dedupeFlush(lru); err != nil {
+		hook.fileError(lru, err, "failed to write log file:")
+	}
+	if err := lru.close(); err != nil {
+		hook.fileError(lru, err, "failed to close log file:")
+	}
+	lru.release()
+	lru.closed = true
+	delete(hook.routes, lru.tmpl)
+	errs := lru.errs
+	lru.errs = nil
+	return errs
+}
@@ -0,0 +1,99 @@
+package loglfshook
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// lfsSampler limits the entries of each level to n per interval.
+type lfsSampler struct {
+	n       int
+	per     time.Duration
+	windows [logrus.TraceLevel + 1]lfsWindow
+}
+
+// lfsWindow is the sampling window of a level, each level has its own lock.
+type lfsWindow struct {
+	mu         sync.Mutex
+	start      time.Time
+	count      int
+	suppressed int
+}
+
+// allow reports whether the entry of the level is written, and the count of the entries suppressed
+// in the previous window if the window is reset by this entry.
+func (s *lfsSampler) allow(level logrus.Level, now time.Time) (bool, int) {
+	if level > logrus.TraceLevel {
+		return true, 0
+	}
+	w := &s.windows[level]
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	suppressed := 0
+	if now.Sub(w.start) >= s.per {
+		suppressed = w.suppressed
+		w.start = now
+		w.count = 0
+		w.suppressed = 0
+	}
+	if w.count >= s.n {
+		w.suppressed++
+		return false, 0
+	}
+	w.count++
+	return true, suppressed
+}
+
+// Sample writes n entries per interval at most for each level, the others are suppressed.
+// A summary entry with the count of the suppressed entries is written when the next window starts.
+// A zero n disables the sampling.
+func (hook *LfsHook) Sample(n int, per time.Duration) {
+	hook.lock.Lock()
+	defer hook.lock.Unlock()
+	hook.sampler = newSampler(n, per)
+}
+func newSampler(n int, per time.Duration) *lfsSampler {
+	if n <= 0 {
+		return nil
+	}
+	return &lfsSampler{n: n, per: per}
+}
+
+// SetSampling writes 1 of every n entries of the level, starting with the first one.
+// The skipped entries are counted in Stats.SampledOut. A n of 1 or less writes all the entries.
+// The fatal and panic entries are never skipped. It can be called while logging.
+func (hook *LfsHook) SetSampling(level logrus.Level, n int) {
+	if level > logrus.TraceLevel {
+		return
+	}
+	if n < 1 {
+		n = 1
+	}
+	atomic.StoreUint32(&hook.rates[level], uint32(n))
+}
+
+// sampledOut reports whether the entry of the level is skipped by SetSampling, it's checked before
+// taking any lock or formatting, so the skipped entries are cheap.
+func (hook *LfsHook) sampledOut(level logrus.Level) bool {
+	if level <= logrus.FatalLevel || level > logrus.TraceLevel {
+		return false
+	}
+	n := atomic.LoadUint32(&hook.rates[level])
+	if n <= 1 || (atomic.AddUint32(&hook.ticks[level], 1)-1)%n == 0 {
+		return false
+	}
+	atomic.AddUint64(&hook.stats.sampled, 1)
+	return true
+}
+
+// sampleSummary returns the summary entry of the suppressed entries of the level.
+func sampleSummary(entry *logrus.Entry, suppressed int, now time.Time) *logrus.Entry {
+	summary := logrus.NewEntry(entry.Logger)
+	summary.Time = now
+	summary.Level = entry.Level
+	summary.Message = fmt.Sprintf("suppressed %d entries", suppressed)
+	return summary
+}
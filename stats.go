@@ -0,0 +1,68 @@
+package loglfshook
+
+import (
+	"github.com/sirupsen/logrus"
+	"sync/atomic"
+)
+
+// Stats is the cumulative counters of a hook since it's created.
+type Stats struct {
+	BytesWritten   uint64
+	LinesWritten   uint64
+	Rotations      uint64
+	WriteErrors    uint64
+	DroppedEntries uint64
+	// Retries is the count of the writes retried by WriteRetries.
+	Retries uint64
+	// SampledOut is the count of the entries skipped by SetSampling.
+	SampledOut uint64
+	// LevelBytes is the bytes written of each level, the levels never written are omitted.
+	LevelBytes map[logrus.Level]uint64
+}
+
+// lfsStats is updated atomically, it must be the first field of LfsHook to be 64-bit aligned.
+type lfsStats struct {
+	bytes     uint64
+	lines     uint64
+	rotations uint64
+	errors    uint64
+	dropped   uint64
+	sampled   uint64
+	retries   uint64
+	levels    [logrus.TraceLevel + 1]uint64
+}
+
+// written counts a write of n bytes of the level, the line is counted if the write succeeded.
+func (st *lfsStats) written(level logrus.Level, n int, err error) {
+	if n > 0 {
+		atomic.AddUint64(&st.bytes, uint64(n))
+		if level <= logrus.TraceLevel {
+			atomic.AddUint64(&st.levels[level], uint64(n))
+		}
+	}
+	if err != nil {
+		atomic.AddUint64(&st.errors, 1)
+	} else {
+		atomic.AddUint64(&st.lines, 1)
+	}
+}
+
+// Stats returns the counters of the hook, it can be called at any time without blocking the writes.
+func (hook *LfsHook) Stats() Stats {
+	levels := make(map[logrus.Level]uint64)
+	for level := range hook.stats.levels {
+		if n := atomic.LoadUint64(&hook.stats.levels[level]); n > 0 {
+			levels[logrus.Level(level)] = n
+		}
+	}
+	return Stats{
+		BytesWritten:   atomic.LoadUint64(&hook.stats.bytes),
+		LinesWritten:   atomic.LoadUint64(&hook.stats.lines),
+		Rotations:      atomic.LoadUint64(&hook.stats.rotations),
+		WriteErrors:    atomic.LoadUint64(&hook.stats.errors),
+		DroppedEntries: atomic.LoadUint64(&hook.stats.dropped),
+		SampledOut:     atomic.LoadUint64(&hook.stats.sampled),
+		Retries:        atomic.LoadUint64(&hook.stats.retries),
+		LevelBytes:     levels,
+	}
+}
@@ -0,0 +1,53 @@
+package loglfshook
+
+import (
+	"github.com/sirupsen/logrus"
+	"os"
+)
+
+// CurrentPath returns the path of the active file of the level, the opened file if any, otherwise
+// the path the next entry would be written to like PathFor. It returns false if the level isn't written to a file.
+func (hook *LfsHook) CurrentPath(level logrus.Level) (string, bool) {
+	path, _, ok := hook.currentFile(level)
+	return path, ok
+}
+
+// CurrentSize returns the size of the active file of the level, including the buffered bytes not written yet.
+// A file not opened yet is checked on the disk, 0 is returned if it doesn't exist.
+// It returns -1 if the level isn't written to a file.
+func (hook *LfsHook) CurrentSize(level logrus.Level) int64 {
+	path, size, ok := hook.currentFile(level)
+	if !ok {
+		return -1
+	}
+	if size >= 0 {
+		return size
+	}
+	if stat, err := os.Stat(path); err == nil {
+		return stat.Size()
+	}
+	return 0
+}
+
+// currentFile returns the path and the size of the opened file of the level, the size is -1 if it's not opened.
+// hook.lock is released before taking the lock of the file, so a slow write delays only this call.
+func (hook *LfsHook) currentFile(level logrus.Level) (string, int64, bool) {
+	hook.lock.Lock()
+	tmpl, ok := hook.filePath(level)
+	hook.lock.Unlock()
+	if !ok {
+		return "", -1, false
+	}
+
+	hook.flk.Lock()
+	fe := hook.fls[tmpl]
+	hook.flk.Unlock()
+	if fe != nil {
+		fe.lk.Lock()
+		defer fe.lk.Unlock()
+		if fe.fd != nil && !fe.closed {
+			return fe.path, fe.ln, true
+		}
+	}
+	return expandPath(tmpl, hook.now()), -1, true
+}
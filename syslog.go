@@ -0,0 +1,60 @@
+package loglfshook
+
+import "github.com/sirupsen/logrus"
+
+// SyslogWriter is the part of *syslog.Writer used by the hook, so log/syslog isn't imported for the file-only users.
+type SyslogWriter interface {
+	Emerg(m string) error
+	Crit(m string) error
+	Err(m string) error
+	Warning(m string) error
+	Info(m string) error
+	Debug(m string) error
+}
+
+// SetSyslog writes each entry to the syslog writer too, in addition to the file or writer of its level.
+// The levels are mapped to the syslog priorities: Panic to LOG_EMERG, Fatal to LOG_CRIT, Error to LOG_ERR,
+// Warn to LOG_WARNING, Info to LOG_INFO, Debug and Trace to LOG_DEBUG. A nil writer disables it.
+func (hook *LfsHook) SetSyslog(writer SyslogWriter) {
+	hook.lock.Lock()
+	defer hook.lock.Unlock()
+	hook.syslog = writer
+}
+
+// syslogWrite writes the entry to the syslog writer if any and returns the error of the output
+// or else the syslog error.
+func (hook *LfsHook) syslogWrite(writer SyslogWriter, formatter logrus.Formatter, entry *logrus.Entry, err error) error {
+	if writer == nil {
+		return err
+	}
+	msg, e := formatter.Format(entry)
+	if e != nil {
+		hook.handleError(e, entry, "failed to generate string for entry:")
+	} else {
+		e = syslogLevel(writer, entry.Level)(string(msg))
+		if e != nil {
+			hook.handleError(e, entry, "failed to write syslog:")
+		}
+	}
+	if err == nil {
+		err = e
+	}
+	return err
+}
+
+// syslogLevel returns the function writing the priority of the level.
+func syslogLevel(writer SyslogWriter, level logrus.Level) func(m string) error {
+	switch level {
+	case logrus.PanicLevel:
+		return writer.Emerg
+	case logrus.FatalLevel:
+		return writer.Crit
+	case logrus.ErrorLevel:
+		return writer.Err
+	case logrus.WarnLevel:
+		return writer.Warning
+	case logrus.InfoLevel:
+		return writer.Info
+	}
+	return writer.Debug
+}
@@ -0,0 +1,28 @@
+package loglfshook
+
+import (
+	"bytes"
+	"github.com/sirupsen/logrus"
+)
+
+// NewTestHook returns a hook writing each level to its own in-memory buffer, for the tests asserting
+// the logged content without touching the filesystem. The returned func reads what was logged at the level.
+func NewTestHook() (*LfsHook, func(level logrus.Level) string) {
+	bufs := make(map[logrus.Level]*bytes.Buffer)
+	writers := make(WriterMap)
+	for _, level := range logrus.AllLevels {
+		bufs[level] = new(bytes.Buffer)
+		writers[level] = bufs[level]
+	}
+	hook := NewLfsHook(writers, nil)
+	return hook, func(level logrus.Level) string {
+		buf, ok := bufs[level]
+		if !ok {
+			return ""
+		}
+		// the writers are written under the lock
+		hook.lock.Lock()
+		defer hook.lock.Unlock()
+		return buf.String()
+	}
+}
@@ -0,0 +1,56 @@
+package loglfshook
+
+import (
+	"fmt"
+	"os"
+)
+
+// uploadQueueSize is the max count of the rotated files waiting for OnRotateUpload.
+const uploadQueueSize = 64
+
+// fileUpload queues the rotated file for OnRotateUpload, it never blocks the rotation.
+// The file is skipped with an error if the queue is full, the caller must hold fe.lk.
+func (c *LfsHook) fileUpload(fe *lfsFile, name string) {
+	if c.OnRotateUpload == nil {
+		return
+	}
+	c.ulk.Lock()
+	defer c.ulk.Unlock()
+	if c.uploads == nil {
+		c.uploads = make(chan string, uploadQueueSize)
+		c.uwg.Add(1)
+		go c.uploadLoop(c.uploads)
+	}
+	select {
+	case c.uploads <- name:
+	default:
+		c.fileError(fe, fmt.Errorf("upload queue is full, %s is skipped", name), "failed to upload log file:")
+	}
+}
+
+// uploadLoop calls OnRotateUpload for the queued files one by one until the queue is closed.
+func (c *LfsHook) uploadLoop(uploads chan string) {
+	defer c.uwg.Done()
+	for name := range uploads {
+		// wait for the pending compression, the compressed file is uploaded if any
+		c.zlk.Lock()
+		c.zlk.Unlock()
+		if _, err := os.Stat(name + compressSuffix); err == nil {
+			name += compressSuffix
+		}
+		if err := c.OnRotateUpload(name); err != nil {
+			c.handleError(err, nil, "failed to upload log file:")
+		}
+	}
+}
+
+// stopUpload waits for the queued uploads and stops the upload goroutine, it's restarted by the next rotation.
+func (c *LfsHook) stopUpload() {
+	c.ulk.Lock()
+	if c.uploads != nil {
+		close(c.uploads)
+		c.uploads = nil
+	}
+	c.ulk.Unlock()
+	c.uwg.Wait()
+}
@@ -0,0 +1,97 @@
+package loglfshook
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+)
+
+// Validate checks all the configured paths are writable, so the errors can be reported at startup
+// instead of the first Fire. The directories are created and the files are opened for append,
+// the files not existing before are removed afterward. It returns the errors of all the paths,
+// each prefixed by the level or the kind of the path.
+// The levels without any output are reported once to OnError, or printed if OnError is nil,
+// they aren't returned since a hook may leave some levels out on purpose.
+func (hook *LfsHook) Validate() error {
+	hook.lock.Lock()
+	var paths, names []string
+	add := func(name, path string) {
+		names = append(names, name)
+		paths = append(paths, path)
+	}
+	for level, path := range hook.paths {
+		add("level "+level.String(), path)
+	}
+	if hook.levelDir != "" {
+		levels := logrus.AllLevels
+		if hook.hasLevels {
+			levels = hook.levels
+		}
+		for _, level := range levels {
+			add("level "+level.String(), filepath.Join(hook.levelDir, level.String()+".log"))
+		}
+	}
+	if hook.hasDefaultPath {
+		add("default path", hook.defaultPath)
+	}
+	if hook.combinedPath != "" {
+		add("combined path", hook.combinedPath)
+	}
+	for level, writer := range hook.writers {
+		if writer == nil {
+			add("level "+level.String(), "")
+		}
+	}
+	var unmatched []logrus.Level
+	for _, level := range logrus.AllLevels {
+		// the levels left out by SetLevels are never fired
+		if hook.hasLevels && !hook.hasLevel(level) {
+			continue
+		}
+		if !hook.hasOutput(&logrus.Entry{Level: level}) {
+			unmatched = append(unmatched, level)
+		}
+	}
+	hook.lock.Unlock()
+	for _, level := range unmatched {
+		hook.warnUnmatched(level, nil)
+	}
+
+	var errs multiError
+	checked := make(map[string]bool)
+	now := hook.now()
+	for i, path := range paths {
+		if path == "" {
+			errs = append(errs, fmt.Errorf("%s: empty path or nil writer", names[i]))
+			continue
+		}
+		path = expandPath(path, now)
+		if checked[path] {
+			continue
+		}
+		checked[path] = true
+		if err := hook.fileValidate(path); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", names[i], err))
+		}
+	}
+	return errs.err()
+}
+
+// fileValidate opens the path for append like fileCheck, the file is removed if it's created.
+func (hook *LfsHook) fileValidate(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), hook.DirMode); err != nil {
+		return err
+	}
+	_, err := os.Stat(path)
+	created := os.IsNotExist(err)
+	fl, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, hook.FileMode)
+	if err != nil {
+		return err
+	}
+	err = fl.Close()
+	if created {
+		os.Remove(path)
+	}
+	return err
+}